@@ -0,0 +1,327 @@
+/* Licensed to the Apache Software Foundation (ASF) under one or more
+contributor license agreements.  See the NOTICE file distributed with
+this work for additional information regarding copyright ownership.
+The ASF licenses this file to You under the Apache License, Version 2.0
+(the "License"); you may not use this file except in compliance with
+the License.  You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License. */
+
+package go_kafka_client
+
+import (
+	"fmt"
+	"sort"
+)
+
+// TopicAndPartition uniquely identifies a single partition of a topic.
+type TopicAndPartition struct {
+	Topic     string
+	Partition int32
+}
+
+func (tp TopicAndPartition) String() string {
+	return fmt.Sprintf("%s-%d", tp.Topic, tp.Partition)
+}
+
+// AssignmentContext carries everything a PartitionAssignmentStrategy needs to
+// compute a new assignment for a consumer group: who the current members are,
+// what each of them is subscribed to, how many partitions each subscribed
+// topic has, and (if a rebalance is in progress) what each member owned going
+// into it.
+type AssignmentContext struct {
+	Group               string
+	Members             []string
+	MemberSubscriptions map[string][]string
+	PartitionsPerTopic  map[string][]int32
+	PreviousAssignment  map[string][]TopicAndPartition
+
+	// MemberMetadata holds the opaque UserData every member published into
+	// its registration znode when it joined the group (ConsumerConfig's
+	// GroupMemberMetadata/MetadataFunc). Strategies that want to take
+	// locality, hardware, or other member-specific hints into account read
+	// it here; strategies that don't care about it can ignore it entirely.
+	MemberMetadata map[string][]byte
+}
+
+// PartitionAssignmentStrategy computes how the partitions of the topics a
+// group is subscribed to should be distributed across its members. It is run
+// by the elected group leader once per rebalance.
+type PartitionAssignmentStrategy interface {
+	// Name identifies the strategy, e.g. for logging and for the protocol
+	// metadata exchanged between members.
+	Name() string
+
+	// Assign returns, for every member in context.Members, the set of
+	// partitions that member should own once the rebalance completes.
+	Assign(context *AssignmentContext) map[string][]TopicAndPartition
+}
+
+// RangeStrategy assigns each topic's partitions as contiguous ranges across
+// the members subscribed to that topic, the same algorithm the original
+// Kafka high-level consumer used.
+type RangeStrategy struct{}
+
+func (*RangeStrategy) Name() string { return "range" }
+
+func (*RangeStrategy) Assign(context *AssignmentContext) map[string][]TopicAndPartition {
+	assignment := make(map[string][]TopicAndPartition)
+	for _, member := range context.Members {
+		assignment[member] = make([]TopicAndPartition, 0)
+	}
+
+	for topic, partitions := range context.PartitionsPerTopic {
+		subscribers := membersSubscribedTo(context, topic)
+		if len(subscribers) == 0 {
+			continue
+		}
+		sort.Strings(subscribers)
+		partitionsPerMember := len(partitions) / len(subscribers)
+		extra := len(partitions) % len(subscribers)
+
+		index := 0
+		for i, member := range subscribers {
+			count := partitionsPerMember
+			if i < extra {
+				count++
+			}
+			for j := 0; j < count; j++ {
+				assignment[member] = append(assignment[member], TopicAndPartition{topic, partitions[index]})
+				index++
+			}
+		}
+	}
+	return assignment
+}
+
+// RoundRobinStrategy lays every subscribed topic-partition out in a single
+// sorted list and deals it out to the members one at a time.
+type RoundRobinStrategy struct{}
+
+func (*RoundRobinStrategy) Name() string { return "roundrobin" }
+
+func (*RoundRobinStrategy) Assign(context *AssignmentContext) map[string][]TopicAndPartition {
+	assignment := make(map[string][]TopicAndPartition)
+	members := make([]string, len(context.Members))
+	copy(members, context.Members)
+	sort.Strings(members)
+	for _, member := range members {
+		assignment[member] = make([]TopicAndPartition, 0)
+	}
+	if len(members) == 0 {
+		return assignment
+	}
+
+	all := allPartitions(context)
+	next := 0
+	for _, tp := range all {
+		member := nextSubscribedMember(context, members, tp.Topic, &next)
+		if member == "" {
+			// nobody in the group is subscribed to this topic
+			continue
+		}
+		assignment[member] = append(assignment[member], tp)
+	}
+	return assignment
+}
+
+// nextSubscribedMember advances the shared circular cursor *next over
+// members until it finds one subscribed to topic, wrapping at most once
+// around the full member list. It leaves *next pointing just past whichever
+// member it returns, so repeated calls keep round-robining forward instead
+// of restarting from the same member every time.
+func nextSubscribedMember(context *AssignmentContext, members []string, topic string, next *int) string {
+	for i := 0; i < len(members); i++ {
+		candidate := members[*next%len(members)]
+		*next++
+		if memberSubscribedTo(context, candidate, topic) {
+			return candidate
+		}
+	}
+	return ""
+}
+
+// StickyStrategy behaves like RoundRobinStrategy on the first assignment of a
+// group, but on subsequent rebalances it tries to leave members' existing
+// partitions in place, only moving partitions that must move to keep the
+// overall assignment balanced.
+type StickyStrategy struct{}
+
+func (*StickyStrategy) Name() string { return "sticky" }
+
+func (s *StickyStrategy) Assign(context *AssignmentContext) map[string][]TopicAndPartition {
+	return stickyAssign(context)
+}
+
+// CooperativeStickyStrategy computes the same balanced, ownership-preserving
+// target assignment as StickyStrategy, but is intended to be applied through
+// the coordinator's two-phase cooperative rebalance: partitions a member
+// keeps are never revoked, partitions that must move are revoked from their
+// old owner in the first join round and only handed to their new owner once
+// every member has acknowledged the revoke, in a second round. This keeps
+// members that are not losing anything processing uninterrupted instead of
+// stopping the world on every membership change.
+type CooperativeStickyStrategy struct{}
+
+func (*CooperativeStickyStrategy) Name() string { return "cooperative-sticky" }
+
+func (s *CooperativeStickyStrategy) Assign(context *AssignmentContext) map[string][]TopicAndPartition {
+	return stickyAssign(context)
+}
+
+// Revoked returns the subset of context.PreviousAssignment that the target
+// assignment moves to a different member, i.e. the partitions each member
+// must give up in the first round of a cooperative rebalance before the
+// second round hands them to their new owner.
+func (s *CooperativeStickyStrategy) Revoked(context *AssignmentContext, target map[string][]TopicAndPartition) map[string][]TopicAndPartition {
+	revoked := make(map[string][]TopicAndPartition)
+	for member, owned := range context.PreviousAssignment {
+		stillOwned := make(map[TopicAndPartition]bool)
+		for _, tp := range target[member] {
+			stillOwned[tp] = true
+		}
+		for _, tp := range owned {
+			if !stillOwned[tp] {
+				revoked[member] = append(revoked[member], tp)
+			}
+		}
+	}
+	return revoked
+}
+
+// stickyAssign computes a balanced assignment that minimizes the number of
+// partitions moved relative to context.PreviousAssignment. It first lets
+// every member keep as many of its previously owned partitions as it is
+// still entitled to (bounded by the balanced per-member share), then hands
+// each partition left over to the least-loaded subscribed member that is
+// still under its share. This is a greedy heuristic rather than a true minimum
+// weight bipartite matching, but it converges to the same balanced result
+// while touching the fewest partitions in the common case of one member
+// joining or leaving a stable group.
+func stickyAssign(context *AssignmentContext) map[string][]TopicAndPartition {
+	members := make([]string, len(context.Members))
+	copy(members, context.Members)
+	sort.Strings(members)
+
+	assignment := make(map[string][]TopicAndPartition)
+	for _, member := range members {
+		assignment[member] = make([]TopicAndPartition, 0)
+	}
+	if len(members) == 0 {
+		return assignment
+	}
+
+	all := allPartitions(context)
+	total := len(all)
+	perMember := total / len(members)
+	extra := total % len(members)
+	capacity := make(map[string]int)
+	for i, member := range members {
+		capacity[member] = perMember
+		if i < extra {
+			capacity[member]++
+		}
+	}
+
+	unassigned := make(map[TopicAndPartition]bool)
+	for _, tp := range all {
+		unassigned[tp] = true
+	}
+
+	// Round 1: let every member keep what it already owned, up to its share.
+	for _, member := range members {
+		for _, tp := range context.PreviousAssignment[member] {
+			if !unassigned[tp] {
+				continue
+			}
+			if !memberSubscribedTo(context, member, tp.Topic) {
+				continue
+			}
+			if len(assignment[member]) >= capacity[member] {
+				continue
+			}
+			assignment[member] = append(assignment[member], tp)
+			delete(unassigned, tp)
+		}
+	}
+
+	// Round 2: hand out whatever is left to members that are still under
+	// their share, preferring the least-loaded member each time.
+	leftover := make([]TopicAndPartition, 0, len(unassigned))
+	for _, tp := range all {
+		if unassigned[tp] {
+			leftover = append(leftover, tp)
+		}
+	}
+	for _, tp := range leftover {
+		member := leastLoadedEligibleMember(context, assignment, capacity, tp.Topic)
+		if member == "" {
+			continue
+		}
+		assignment[member] = append(assignment[member], tp)
+	}
+
+	return assignment
+}
+
+func leastLoadedEligibleMember(context *AssignmentContext, assignment map[string][]TopicAndPartition, capacity map[string]int, topic string) string {
+	best := ""
+	bestLoad := -1
+	for _, member := range context.Members {
+		if !memberSubscribedTo(context, member, topic) {
+			continue
+		}
+		if len(assignment[member]) >= capacity[member] {
+			continue
+		}
+		if bestLoad == -1 || len(assignment[member]) < bestLoad {
+			best = member
+			bestLoad = len(assignment[member])
+		}
+	}
+	return best
+}
+
+func membersSubscribedTo(context *AssignmentContext, topic string) []string {
+	members := make([]string, 0)
+	for _, member := range context.Members {
+		if memberSubscribedTo(context, member, topic) {
+			members = append(members, member)
+		}
+	}
+	return members
+}
+
+func memberSubscribedTo(context *AssignmentContext, member string, topic string) bool {
+	for _, subscribed := range context.MemberSubscriptions[member] {
+		if subscribed == topic {
+			return true
+		}
+	}
+	return false
+}
+
+func allPartitions(context *AssignmentContext) []TopicAndPartition {
+	topics := make([]string, 0, len(context.PartitionsPerTopic))
+	for topic := range context.PartitionsPerTopic {
+		topics = append(topics, topic)
+	}
+	sort.Strings(topics)
+
+	all := make([]TopicAndPartition, 0)
+	for _, topic := range topics {
+		partitions := make([]int32, len(context.PartitionsPerTopic[topic]))
+		copy(partitions, context.PartitionsPerTopic[topic])
+		sort.Slice(partitions, func(i, j int) bool { return partitions[i] < partitions[j] })
+		for _, partition := range partitions {
+			all = append(all, TopicAndPartition{topic, partition})
+		}
+	}
+	return all
+}
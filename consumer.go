@@ -0,0 +1,602 @@
+/* Licensed to the Apache Software Foundation (ASF) under one or more
+contributor license agreements.  See the NOTICE file distributed with
+this work for additional information regarding copyright ownership.
+The ASF licenses this file to You under the Apache License, Version 2.0
+(the "License"); you may not use this file except in compliance with
+the License.  You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License. */
+
+package go_kafka_client
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/Shopify/sarama"
+)
+
+// OffsetValue picks where a consumer starts reading a partition it has no
+// committed offset for yet.
+type OffsetValue string
+
+const (
+	SmallestOffset OffsetValue = "smallest"
+	LargestOffset  OffsetValue = "largest"
+)
+
+// ConsumerConfig configures a single Consumer instance.
+type ConsumerConfig struct {
+	Groupid    string
+	Consumerid string
+
+	NumWorkers          int
+	NumConsumerFetchers int
+	FetchBatchSize      int
+	FetchBatchTimeout   time.Duration
+
+	AutoOffsetReset OffsetValue
+
+	Strategy                    WorkerStrategy
+	BatchStrategy               BatchWorkerStrategy
+	OffsetCommitMode            OffsetCommitMode
+	WorkerFailureCallback       func(*WorkerManager) FailedDecision
+	WorkerFailedAttemptCallback func(*Task, WorkerResult) FailedDecision
+
+	Coordinator ConsumerCoordinator
+
+	// BrokerList is the set of Kafka broker addresses (host:port) this
+	// consumer fetches messages from.
+	BrokerList []string
+
+	TopicMetadataRefreshInterval time.Duration
+	ExcludeInternalTopics        bool
+
+	OffsetsCommitMaxRetries int
+
+	// GroupMemberMetadata is the opaque UserData published into this
+	// consumer's registration znode when it joins a group. MetadataFunc, if
+	// set, takes priority and is called fresh on every (re)registration, so
+	// dynamic content (like current load) can be reflected.
+	GroupMemberMetadata []byte
+	MetadataFunc        func() []byte
+
+	PartitionAssignmentStrategy PartitionAssignmentStrategy
+}
+
+// DefaultConsumerConfig returns a ConsumerConfig with the same defaults the
+// rest of the client assumes unless a test or application overrides them.
+func DefaultConsumerConfig() *ConsumerConfig {
+	return &ConsumerConfig{
+		Consumerid:                   fmt.Sprintf("consumer-%d", time.Now().UnixNano()),
+		NumWorkers:                   4,
+		NumConsumerFetchers:          1,
+		FetchBatchSize:               1000,
+		FetchBatchTimeout:            1 * time.Second,
+		AutoOffsetReset:              LargestOffset,
+		OffsetCommitMode:             Automatic,
+		TopicMetadataRefreshInterval: 1 * time.Minute,
+		OffsetsCommitMaxRetries:      5,
+		PartitionAssignmentStrategy:  &RangeStrategy{},
+	}
+}
+
+func (c *ConsumerConfig) memberMetadata() []byte {
+	if c.MetadataFunc != nil {
+		return c.MetadataFunc()
+	}
+	return c.GroupMemberMetadata
+}
+
+// Consumer reads messages from one or more topics as part of a consumer
+// group, dispatching them to a WorkerManager built from its ConsumerConfig.
+type Consumer struct {
+	config *ConsumerConfig
+
+	workerManager *WorkerManager
+
+	highWaterMarks *highWaterMarkTracker
+	offsetBarrier  *offsetVisibilityBarrier
+	offsetStage    *offsetStage
+
+	topicRegistryLock sync.Mutex
+	subscribedTopics  []string
+	topicPoller       *topicMetadataPoller
+
+	// fetchingPartitions holds the stop channel for every partition this
+	// consumer currently has a fetchPartition goroutine running for. Closing
+	// a partition's channel (and removing it here) tells that goroutine to
+	// shut down, e.g. because a rebalance moved the partition to a different
+	// member or a wildcard subscription dropped its topic.
+	fetchingLock       sync.Mutex
+	fetchingPartitions map[TopicAndPartition]chan bool
+
+	kafkaConsumerLock sync.Mutex
+	kafkaConsumer     sarama.Consumer
+
+	closeOnce sync.Once
+	stopChan  chan bool
+}
+
+// NewConsumer builds a Consumer from config. It does not start consuming;
+// call StartStatic or StartWildcard for that.
+func NewConsumer(config *ConsumerConfig) *Consumer {
+	consumer := &Consumer{
+		config:             config,
+		highWaterMarks:     newHighWaterMarkTracker(),
+		offsetBarrier:      newOffsetVisibilityBarrier(),
+		offsetStage:        newOffsetStage(),
+		fetchingPartitions: make(map[TopicAndPartition]chan bool),
+		stopChan:           make(chan bool),
+	}
+	consumer.workerManager = newWorkerManager(consumer)
+	return consumer
+}
+
+func (c *Consumer) String() string {
+	return fmt.Sprintf("%s-%s", c.config.Groupid, c.config.Consumerid)
+}
+
+// StartStatic joins the consumer's group with a fixed topic -> stream count
+// map, e.g. {"my-topic": 3}. Its subscription never changes on its own; use
+// StartWildcard for a subscription that tracks a whitelist/blacklist.
+func (c *Consumer) StartStatic(topicCountMap map[string]int) error {
+	if err := c.config.Coordinator.Connect(); err != nil {
+		return err
+	}
+
+	topics := make([]string, 0, len(topicCountMap))
+	for topic := range topicCountMap {
+		topics = append(topics, topic)
+	}
+	c.topicRegistryLock.Lock()
+	c.subscribedTopics = topics
+	c.topicRegistryLock.Unlock()
+
+	if err := c.config.Coordinator.RegisterConsumer(c.config.Groupid, c.config.Consumerid, topics, c.config.memberMetadata()); err != nil {
+		return err
+	}
+
+	return c.rebalanceAndConsume()
+}
+
+// StartWildcard joins the consumer's group subscribed to every topic
+// currently matching filter, and keeps that subscription up to date via a
+// background topicMetadataPoller.
+func (c *Consumer) StartWildcard(filter TopicFilter, numStreams int) error {
+	if err := c.config.Coordinator.Connect(); err != nil {
+		return err
+	}
+
+	poller := newTopicMetadataPoller(c, filter)
+	topics := poller.resolve()
+	c.topicRegistryLock.Lock()
+	c.topicPoller = poller
+	c.subscribedTopics = topics
+	c.topicRegistryLock.Unlock()
+
+	if err := c.config.Coordinator.RegisterConsumer(c.config.Groupid, c.config.Consumerid, topics, c.config.memberMetadata()); err != nil {
+		return err
+	}
+	go poller.Start()
+
+	return c.rebalanceAndConsume()
+}
+
+// Close stops the worker manager, the topic metadata poller (if running),
+// and disconnects from the coordinator.
+func (c *Consumer) Close() error {
+	var err error
+	c.closeOnce.Do(func() {
+		close(c.stopChan)
+		c.workerManager.Stop()
+
+		c.topicRegistryLock.Lock()
+		poller := c.topicPoller
+		c.topicRegistryLock.Unlock()
+		if poller != nil {
+			poller.Stop()
+		}
+
+		c.kafkaConsumerLock.Lock()
+		if c.kafkaConsumer != nil {
+			c.kafkaConsumer.Close()
+		}
+		c.kafkaConsumerLock.Unlock()
+
+		err = c.config.Coordinator.Close()
+	})
+	return err
+}
+
+// rebalanceAndConsume runs the (currently single-phase, see
+// applyCooperativeRebalance for the cooperative path) assignment for this
+// consumer's subscribed topics, waits for the committed offsets it owns to
+// become visible, and starts the worker manager and fetchers.
+func (c *Consumer) rebalanceAndConsume() error {
+	assigned, err := c.assignPartitions()
+	if err != nil {
+		return err
+	}
+
+	c.awaitAssignedPartitionsVisible(assigned)
+
+	c.workerManager.Start()
+	c.startFetchersFor(assigned)
+	return nil
+}
+
+// startFetchersFor launches a fetchPartition goroutine for every partition in
+// assigned that isn't already being fetched. It is safe to call repeatedly
+// as a consumer's assignment grows, which is what lets the topic metadata
+// poller join newly-matching topics into a running consumer without a
+// restart.
+func (c *Consumer) startFetchersFor(assigned []TopicAndPartition) {
+	c.fetchingLock.Lock()
+	defer c.fetchingLock.Unlock()
+
+	for _, tp := range assigned {
+		if _, exists := c.fetchingPartitions[tp]; exists {
+			continue
+		}
+		stop := make(chan bool)
+		c.fetchingPartitions[tp] = stop
+		go c.fetchPartition(tp, stop)
+	}
+}
+
+// stopFetchersNotIn stops and forgets the fetcher for every partition this
+// consumer is currently fetching that isn't in assigned, e.g. one it gave up
+// in a rebalance or whose topic dropped out of a wildcard subscription.
+func (c *Consumer) stopFetchersNotIn(assigned []TopicAndPartition) {
+	stillAssigned := make(map[TopicAndPartition]bool, len(assigned))
+	for _, tp := range assigned {
+		stillAssigned[tp] = true
+	}
+
+	c.fetchingLock.Lock()
+	defer c.fetchingLock.Unlock()
+	for tp, stop := range c.fetchingPartitions {
+		if stillAssigned[tp] {
+			continue
+		}
+		close(stop)
+		delete(c.fetchingPartitions, tp)
+	}
+}
+
+// assignPartitions asks the coordinator for the whole group's membership and
+// subscriptions, every subscribed topic's partitions, and who currently owns
+// them, runs this consumer's PartitionAssignmentStrategy over that, and
+// reconciles the coordinator's ownership znodes with the result.
+func (c *Consumer) assignPartitions() ([]TopicAndPartition, error) {
+	members, err := c.config.Coordinator.GetConsumersInGroup(c.config.Groupid)
+	if err != nil {
+		return nil, err
+	}
+
+	memberSubscriptions := make(map[string][]string, len(members))
+	memberMetadata := make(map[string][]byte, len(members))
+	topicSet := make(map[string]bool)
+	for _, member := range members {
+		topics, metadata, err := c.config.Coordinator.GetConsumerRegistration(c.config.Groupid, member)
+		if err != nil {
+			return nil, err
+		}
+		memberSubscriptions[member] = topics
+		memberMetadata[member] = metadata
+		for _, topic := range topics {
+			topicSet[topic] = true
+		}
+	}
+
+	partitionsPerTopic := make(map[string][]int32, len(topicSet))
+	for topic := range topicSet {
+		partitions, err := c.config.Coordinator.GetTopicPartitions(topic)
+		if err != nil {
+			return nil, err
+		}
+		partitionsPerTopic[topic] = partitions
+	}
+
+	previous, err := c.currentOwnership(partitionsPerTopic)
+	if err != nil {
+		return nil, err
+	}
+
+	context := &AssignmentContext{
+		Group:               c.config.Groupid,
+		Members:             members,
+		MemberSubscriptions: memberSubscriptions,
+		PartitionsPerTopic:  partitionsPerTopic,
+		PreviousAssignment:  previous,
+		MemberMetadata:      memberMetadata,
+	}
+
+	strategy := c.config.PartitionAssignmentStrategy
+	if strategy == nil {
+		strategy = &RangeStrategy{}
+	}
+
+	var target map[string][]TopicAndPartition
+	if cooperative, ok := strategy.(*CooperativeStickyStrategy); ok {
+		target, err = c.applyCooperativeRebalance(cooperative, context)
+	} else {
+		target = strategy.Assign(context)
+		err = c.reclaimOwnership(target[c.config.Consumerid], previous[c.config.Consumerid])
+	}
+	if err != nil {
+		return nil, err
+	}
+	return target[c.config.Consumerid], nil
+}
+
+// currentOwnership reads, for every partition in partitionsPerTopic, who the
+// coordinator says currently owns it, grouped by owning consumerId. This is
+// the PreviousAssignment a PartitionAssignmentStrategy like StickyStrategy
+// or CooperativeStickyStrategy needs in order to minimize how many
+// partitions move on a rebalance.
+func (c *Consumer) currentOwnership(partitionsPerTopic map[string][]int32) (map[string][]TopicAndPartition, error) {
+	previous := make(map[string][]TopicAndPartition)
+	for topic, partitions := range partitionsPerTopic {
+		for _, partition := range partitions {
+			tp := TopicAndPartition{topic, partition}
+			owner, err := c.config.Coordinator.GetPartitionOwner(c.config.Groupid, tp)
+			if err != nil {
+				return nil, err
+			}
+			if owner != "" {
+				previous[owner] = append(previous[owner], tp)
+			}
+		}
+	}
+	return previous, nil
+}
+
+// reclaimOwnership releases whatever this consumer previously owned that
+// target no longer includes before claiming target, for every strategy that
+// isn't cooperative-sticky. Releasing first, rather than only claiming the
+// new assignment, matters because the partitions this consumer is giving up
+// need their owner znode cleared before another member can claim them
+// without conflicting with a still-live owner.
+func (c *Consumer) reclaimOwnership(target []TopicAndPartition, previouslyOwned []TopicAndPartition) error {
+	stillOwned := make(map[TopicAndPartition]bool, len(target))
+	for _, tp := range target {
+		stillOwned[tp] = true
+	}
+
+	lost := make([]TopicAndPartition, 0)
+	for _, tp := range previouslyOwned {
+		if !stillOwned[tp] {
+			lost = append(lost, tp)
+		}
+	}
+	if len(lost) > 0 {
+		if err := c.config.Coordinator.ReleasePartitionOwnership(c.config.Groupid, c.config.Consumerid, lost); err != nil {
+			return err
+		}
+	}
+
+	return c.config.Coordinator.ClaimPartitionOwnership(c.config.Groupid, c.config.Consumerid, target)
+}
+
+// applyCooperativeRebalance runs the assignment strategy's target
+// computation and then distributes it in the two rounds the cooperative
+// sticky protocol requires: every partition this consumer must give up is
+// released first, and only once the coordinator confirms every other member
+// has released what it owes does this consumer claim its newly assigned
+// partitions. Partitions already owned that the target assignment leaves in
+// place are never touched, so this consumer keeps processing them the whole
+// time.
+func (c *Consumer) applyCooperativeRebalance(strategy *CooperativeStickyStrategy, context *AssignmentContext) (map[string][]TopicAndPartition, error) {
+	target := strategy.Assign(context)
+	revoked := strategy.Revoked(context, target)
+
+	if mine := revoked[c.config.Consumerid]; len(mine) > 0 {
+		if err := c.config.Coordinator.ReleasePartitionOwnership(c.config.Groupid, c.config.Consumerid, mine); err != nil {
+			return nil, err
+		}
+	}
+
+	allRevoked := make([]TopicAndPartition, 0)
+	for _, partitions := range revoked {
+		allRevoked = append(allRevoked, partitions...)
+	}
+	if len(allRevoked) > 0 {
+		if err := c.config.Coordinator.AwaitPartitionsReleased(c.config.Groupid, allRevoked, 30*time.Second); err != nil {
+			return nil, err
+		}
+	}
+
+	newlyOwned := make([]TopicAndPartition, 0)
+	stillOwned := make(map[TopicAndPartition]bool)
+	for _, tp := range context.PreviousAssignment[c.config.Consumerid] {
+		stillOwned[tp] = true
+	}
+	for _, tp := range target[c.config.Consumerid] {
+		if !stillOwned[tp] {
+			newlyOwned = append(newlyOwned, tp)
+		}
+	}
+	if len(newlyOwned) > 0 {
+		if err := c.config.Coordinator.ClaimPartitionOwnership(c.config.Groupid, c.config.Consumerid, newlyOwned); err != nil {
+			return nil, err
+		}
+	}
+
+	return target, nil
+}
+
+// fetchPartition is the per-partition fetch loop started for every partition
+// this consumer owns. It keeps (re)opening a sarama PartitionConsumer for tp
+// until stop is closed (this partition changed hands) or the Consumer itself
+// is closed. It waits FetchBatchTimeout before retrying when opening the
+// partition fails, and reopens it right away when it closes on its own;
+// fetch errors reported while reading are logged, not retried here.
+func (c *Consumer) fetchPartition(tp TopicAndPartition, stop chan bool) {
+	defer func() {
+		c.fetchingLock.Lock()
+		delete(c.fetchingPartitions, tp)
+		c.fetchingLock.Unlock()
+	}()
+
+	for {
+		select {
+		case <-c.stopChan:
+			return
+		case <-stop:
+			return
+		default:
+		}
+
+		if err := c.consumePartition(tp, stop); err != nil {
+			Errorf(c, "Fetch failed for %s, retrying: %s", tp, err)
+			time.Sleep(c.config.FetchBatchTimeout)
+		}
+	}
+}
+
+// consumePartition opens a sarama partition consumer for tp starting at this
+// group's committed offset (or AutoOffsetReset's default for a brand new
+// partition), reports every fetch's high-water-mark so HighWaterMarks/Lag
+// reflect real broker state, and dispatches messages to the worker manager
+// in batches of up to FetchBatchSize, or whatever arrives within
+// FetchBatchTimeout, whichever comes first. It returns when the partition
+// consumer closes on its own, when stop is closed, or when the Consumer
+// itself is closed.
+func (c *Consumer) consumePartition(tp TopicAndPartition, stop chan bool) error {
+	offset, err := c.startOffset(tp)
+	if err != nil {
+		return err
+	}
+
+	kafkaConsumer, err := c.ensureKafkaConsumer()
+	if err != nil {
+		return err
+	}
+
+	partitionConsumer, err := kafkaConsumer.ConsumePartition(tp.Topic, tp.Partition, offset)
+	if err != nil {
+		return err
+	}
+	defer partitionConsumer.Close()
+
+	batch := make([]*Message, 0, c.config.FetchBatchSize)
+	timer := time.NewTimer(c.config.FetchBatchTimeout)
+	defer timer.Stop()
+
+	flush := func() {
+		if len(batch) == 0 {
+			return
+		}
+		if c.config.OffsetCommitMode == ManualBatch {
+			c.workerManager.dispatchBatch(batch)
+		} else {
+			for _, msg := range batch {
+				c.workerManager.dispatch(msg)
+			}
+		}
+		batch = make([]*Message, 0, c.config.FetchBatchSize)
+	}
+
+	for {
+		select {
+		case <-c.stopChan:
+			flush()
+			return nil
+		case <-stop:
+			flush()
+			return nil
+		case message, ok := <-partitionConsumer.Messages():
+			if !ok {
+				flush()
+				return nil
+			}
+			c.highWaterMarks.update(tp.Topic, tp.Partition, partitionConsumer.HighWaterMarkOffset())
+			batch = append(batch, &Message{
+				Key:       message.Key,
+				Value:     message.Value,
+				Topic:     message.Topic,
+				Partition: message.Partition,
+				Offset:    message.Offset,
+			})
+			if len(batch) >= c.config.FetchBatchSize {
+				flush()
+				resetTimer(timer, c.config.FetchBatchTimeout)
+			}
+		case fetchErr, ok := <-partitionConsumer.Errors():
+			if !ok {
+				continue
+			}
+			Errorf(c, "Fetch error for %s: %s", tp, fetchErr)
+		case <-timer.C:
+			flush()
+			timer.Reset(c.config.FetchBatchTimeout)
+		}
+	}
+}
+
+func resetTimer(timer *time.Timer, d time.Duration) {
+	if !timer.Stop() {
+		select {
+		case <-timer.C:
+		default:
+		}
+	}
+	timer.Reset(d)
+}
+
+// startOffset resolves where consumePartition should begin reading tp: the
+// consumer group's committed offset if it has one, otherwise whichever end
+// of the log AutoOffsetReset names.
+func (c *Consumer) startOffset(tp TopicAndPartition) (int64, error) {
+	committed, err := c.config.Coordinator.GetOffset(c.config.Groupid, tp.Topic, tp.Partition)
+	if err != nil {
+		return 0, err
+	}
+	if committed > 0 {
+		return committed, nil
+	}
+	if c.config.AutoOffsetReset == SmallestOffset {
+		return sarama.OffsetOldest, nil
+	}
+	return sarama.OffsetNewest, nil
+}
+
+// ensureKafkaConsumer lazily dials ConsumerConfig.BrokerList the first time
+// any partition needs to fetch, and reuses the same sarama.Consumer (and its
+// underlying connections) for every partition this Consumer owns afterward.
+func (c *Consumer) ensureKafkaConsumer() (sarama.Consumer, error) {
+	c.kafkaConsumerLock.Lock()
+	defer c.kafkaConsumerLock.Unlock()
+
+	if c.kafkaConsumer != nil {
+		return c.kafkaConsumer, nil
+	}
+	kafkaConsumer, err := sarama.NewConsumer(c.config.BrokerList, sarama.NewConfig())
+	if err != nil {
+		return nil, err
+	}
+	c.kafkaConsumer = kafkaConsumer
+	return kafkaConsumer, nil
+}
+
+// commitOffset is the single code path both the automatic per-message
+// commit cadence (WorkerManager.onSuccess) and the manual Consumer.
+// CommitOffsets go through, so offsetBarrier always learns about this
+// member's most recent commit for a partition regardless of which offset
+// commit mode is configured.
+func (c *Consumer) commitOffset(tp TopicAndPartition, offset int64, metadata string) error {
+	if err := c.config.Coordinator.CommitOffset(c.config.Groupid, tp.Topic, tp.Partition, offset, metadata); err != nil {
+		return err
+	}
+	c.offsetBarrier.recordOwnCommit(tp, offset)
+	return nil
+}
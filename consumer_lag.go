@@ -0,0 +1,101 @@
+/* Licensed to the Apache Software Foundation (ASF) under one or more
+contributor license agreements.  See the NOTICE file distributed with
+this work for additional information regarding copyright ownership.
+The ASF licenses this file to You under the Apache License, Version 2.0
+(the "License"); you may not use this file except in compliance with
+the License.  You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License. */
+
+package go_kafka_client
+
+import "sync"
+
+// highWaterMarkTracker holds the latest high-water-mark the fetchers have
+// observed for every partition a consumer is reading, so applications can
+// inspect lag without standing up a separate admin client.
+type highWaterMarkTracker struct {
+	lock   sync.RWMutex
+	values map[string]map[int32]int64
+}
+
+func newHighWaterMarkTracker() *highWaterMarkTracker {
+	return &highWaterMarkTracker{
+		values: make(map[string]map[int32]int64),
+	}
+}
+
+func (h *highWaterMarkTracker) update(topic string, partition int32, highWaterMark int64) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	if _, exists := h.values[topic]; !exists {
+		h.values[topic] = make(map[int32]int64)
+	}
+	h.values[topic][partition] = highWaterMark
+}
+
+func (h *highWaterMarkTracker) get(topic string, partition int32) (int64, bool) {
+	h.lock.RLock()
+	defer h.lock.RUnlock()
+
+	partitions, exists := h.values[topic]
+	if !exists {
+		return 0, false
+	}
+	hwm, exists := partitions[partition]
+	return hwm, exists
+}
+
+func (h *highWaterMarkTracker) snapshot() map[string]map[int32]int64 {
+	h.lock.RLock()
+	defer h.lock.RUnlock()
+
+	snapshot := make(map[string]map[int32]int64)
+	for topic, partitions := range h.values {
+		copied := make(map[int32]int64, len(partitions))
+		for partition, hwm := range partitions {
+			copied[partition] = hwm
+		}
+		snapshot[topic] = copied
+	}
+	return snapshot
+}
+
+// HighWaterMarks returns a snapshot of the last high-water-mark reported by
+// the broker for every partition this consumer has fetched from, keyed by
+// topic and then partition. Entries stay in place after a partition's
+// fetcher stops.
+func (c *Consumer) HighWaterMarks() map[string]map[int32]int64 {
+	return c.highWaterMarks.snapshot()
+}
+
+// Lag returns how many messages behind the partition's high-water-mark this
+// consumer's last committed offset is. It returns 0 if the high-water-mark
+// is not yet known or the committed offset cannot be read; a partition with
+// no committed offset counts as committed at 0, so its lag is the whole
+// high-water-mark.
+func (c *Consumer) Lag(topic string, partition int32) int64 {
+	hwm, exists := c.highWaterMarks.get(topic, partition)
+	if !exists {
+		return 0
+	}
+
+	committed, err := c.config.Coordinator.GetOffset(c.config.Groupid, topic, partition)
+	if err != nil {
+		Errorf(c, "Failed to read committed offset for %s-%d while computing lag: %s", topic, partition, err)
+		return 0
+	}
+
+	lag := hwm - committed
+	if lag < 0 {
+		return 0
+	}
+	return lag
+}
@@ -123,6 +123,122 @@ func TestWhitelistConsumingSinglePartition(t *testing.T) {
 	closeWithin(t, 10*time.Second, consumer)
 }
 
+func TestWhitelistAutoDiscoverNewTopic(t *testing.T) {
+	consumeStatus := make(chan int)
+	timestamp := time.Now().Unix()
+	existingTopic := fmt.Sprintf("test-autodiscover-%d-1", timestamp)
+	newTopic := fmt.Sprintf("test-autodiscover-%d-2", timestamp)
+
+	CreateMultiplePartitionsTopic(localZk, existingTopic, 1)
+	EnsureHasLeader(localZk, existingTopic)
+	go produceN(t, numMessages, existingTopic, localBroker)
+
+	expectedMessages := numMessages * 2
+
+	config := testConsumerConfig()
+	config.TopicMetadataRefreshInterval = 2 * time.Second
+	config.Strategy = newCountingStrategy(t, expectedMessages, consumeTimeout, consumeStatus)
+	consumer := NewConsumer(config)
+	go consumer.StartWildcard(NewWhiteList(fmt.Sprintf("test-autodiscover-%d-.+", timestamp)), 1)
+
+	//create the matching topic only after the consumer is already running
+	time.Sleep(5 * time.Second)
+	CreateMultiplePartitionsTopic(localZk, newTopic, 1)
+	EnsureHasLeader(localZk, newTopic)
+	go produceN(t, numMessages, newTopic, localBroker)
+
+	if actual := <-consumeStatus; actual != expectedMessages {
+		t.Errorf("Failed to consume %d messages within %s. Actual messages = %d", expectedMessages, consumeTimeout, actual)
+	}
+	closeWithin(t, 10*time.Second, consumer)
+}
+
+func TestConsumerLag(t *testing.T) {
+	consumeStatus := make(chan int)
+	topic := fmt.Sprintf("test-lag-%d", time.Now().Unix())
+
+	CreateMultiplePartitionsTopic(localZk, topic, 1)
+	EnsureHasLeader(localZk, topic)
+	go produceN(t, numMessages, topic, localBroker)
+
+	halfway := numMessages / 2
+	config := testConsumerConfig()
+	config.Strategy = newCountingStrategy(t, halfway, consumeTimeout, consumeStatus)
+	consumer := NewConsumer(config)
+	go consumer.StartStatic(map[string]int{topic: 1})
+
+	if actual := <-consumeStatus; actual != halfway {
+		t.Errorf("Failed to consume %d messages within %s. Actual messages = %d", halfway, consumeTimeout, actual)
+	}
+
+	lag := consumer.Lag(topic, 0)
+	if lag < int64(halfway-10) || lag > int64(halfway+10) {
+		t.Errorf("Expected lag to be approximately %d, got %d", halfway, lag)
+	}
+
+	closeWithin(t, 10*time.Second, consumer)
+}
+
+func TestHandoffHasNoDuplicatesOrGaps(t *testing.T) {
+	topic := fmt.Sprintf("test-handoff-%d", time.Now().Unix())
+	group := fmt.Sprintf("handoff-group-%d", time.Now().Unix())
+
+	CreateMultiplePartitionsTopic(localZk, topic, 1)
+	EnsureHasLeader(localZk, topic)
+	go produceN(t, numMessages, topic, localBroker)
+
+	seen := make(map[string]bool)
+	var seenLock sync.Mutex
+	duplicates := 0
+	allSeen := make(chan bool)
+
+	recordingStrategy := func(_ *Worker, msg *Message, id TaskId) WorkerResult {
+		value := string(msg.Value)
+		inLock(&seenLock, func() {
+			if seen[value] {
+				duplicates++
+			}
+			seen[value] = true
+			if len(seen) == numMessages {
+				allSeen <- true
+			}
+		})
+		return NewSuccessfulResult(id)
+	}
+
+	config1 := testConsumerConfig()
+	config1.Groupid = group
+	config1.Strategy = recordingStrategy
+	consumer1 := NewConsumer(config1)
+	go consumer1.StartStatic(map[string]int{topic: 1})
+
+	//give the first consumer a head start, then have a second one join the
+	//same group and force the partition to change hands
+	time.Sleep(5 * time.Second)
+
+	config2 := testConsumerConfig()
+	config2.Groupid = group
+	config2.Strategy = recordingStrategy
+	consumer2 := NewConsumer(config2)
+	go consumer2.StartStatic(map[string]int{topic: 1})
+
+	select {
+	case <-allSeen:
+	case <-time.After(consumeTimeout):
+		t.Errorf("Failed to consume %d messages within %s. Actual messages = %d", numMessages, consumeTimeout, len(seen))
+	}
+
+	if duplicates != 0 {
+		t.Errorf("Expected zero duplicates across the handoff, got %d", duplicates)
+	}
+	if len(seen) != numMessages {
+		t.Errorf("Expected zero gaps across the handoff, got %d of %d messages", len(seen), numMessages)
+	}
+
+	closeWithin(t, 10*time.Second, consumer1)
+	closeWithin(t, 10*time.Second, consumer2)
+}
+
 func TestMessagesProcessedOnce(t *testing.T) {
 	closeTimeout := 15 * time.Second
 	consumeFinished := make(chan bool)
@@ -287,8 +403,8 @@ func TestBlueGreenDeployment(t *testing.T) {
 		atomicIncrement(&processedActiveMessages, &activeCounterLock)
 		return NewSuccessfulResult(taskId)
 	}
-	blueGroupConsumers := []*Consumer{ createConsumerForGroup(blueGroup, inactiveStrategy), createConsumerForGroup(blueGroup, inactiveStrategy) }
-	greenGroupConsumers := []*Consumer{ createConsumerForGroup(greenGroup, activeStrategy), createConsumerForGroup(greenGroup, activeStrategy) }
+	blueGroupConsumers := []*Consumer{createConsumerForGroup(blueGroup, inactiveStrategy), createConsumerForGroup(blueGroup, inactiveStrategy)}
+	greenGroupConsumers := []*Consumer{createConsumerForGroup(greenGroup, activeStrategy), createConsumerForGroup(greenGroup, activeStrategy)}
 
 	for _, consumer := range blueGroupConsumers {
 		go consumer.StartStatic(map[string]int{
@@ -360,6 +476,216 @@ func TestBlueGreenDeployment(t *testing.T) {
 	}
 }
 
+func TestCooperativeRebalance(t *testing.T) {
+	strategy := &CooperativeStickyStrategy{}
+
+	//three members already own a balanced assignment of a 9-partition topic
+	topic := "cooperative-rebalance-topic"
+	partitions := make([]int32, 9)
+	for i := range partitions {
+		partitions[i] = int32(i)
+	}
+
+	previous := map[string][]TopicAndPartition{
+		"member-1": {{topic, 0}, {topic, 1}, {topic, 2}},
+		"member-2": {{topic, 3}, {topic, 4}, {topic, 5}},
+		"member-3": {{topic, 6}, {topic, 7}, {topic, 8}},
+	}
+	subscriptions := map[string][]string{
+		"member-1": {topic},
+		"member-2": {topic},
+		"member-3": {topic},
+		"member-4": {topic},
+	}
+
+	context := &AssignmentContext{
+		Group:               "cooperative-rebalance-group",
+		Members:             []string{"member-1", "member-2", "member-3", "member-4"},
+		MemberSubscriptions: subscriptions,
+		PartitionsPerTopic:  map[string][]int32{topic: partitions},
+		PreviousAssignment:  previous,
+	}
+
+	target := strategy.Assign(context)
+
+	//every member ends up with its fair share
+	for _, member := range context.Members {
+		if len(target[member]) != 2 && len(target[member]) != 3 {
+			t.Errorf("Expected member %s to own 2 or 3 partitions, got %d", member, len(target[member]))
+		}
+	}
+	owners := make(map[TopicAndPartition]string)
+	for member, owned := range target {
+		for _, tp := range owned {
+			if other, exists := owners[tp]; exists {
+				t.Errorf("Partition %v assigned to both %s and %s", tp, other, member)
+			}
+			owners[tp] = member
+		}
+	}
+
+	//the new member only steals its fair share, not an arbitrary amount
+	if len(target["member-4"]) > 3 {
+		t.Errorf("Expected joining member to own at most 3 partitions, got %d", len(target["member-4"]))
+	}
+
+	//members that keep a partition are never asked to revoke it
+	revoked := strategy.Revoked(context, target)
+	for member, owned := range previous {
+		stillOwned := make(map[TopicAndPartition]bool)
+		for _, tp := range target[member] {
+			stillOwned[tp] = true
+		}
+		for _, tp := range owned {
+			if stillOwned[tp] {
+				for _, r := range revoked[member] {
+					if r == tp {
+						t.Errorf("Partition %v was revoked from %s even though it keeps ownership", tp, member)
+					}
+				}
+			}
+		}
+	}
+}
+
+func TestRackAwareAssignmentRespectsLocality(t *testing.T) {
+	topic := "rack-aware-topic"
+	//leaders are split 2/1 across racks "a" and "b"
+	strategy := &RackAwareRangeStrategy{
+		BrokerRacks: map[int32]string{
+			1: "a",
+			2: "a",
+			3: "b",
+		},
+		PartitionLeaders: map[TopicAndPartition]int32{
+			{topic, 0}: 1,
+			{topic, 1}: 2,
+			{topic, 2}: 3,
+		},
+	}
+
+	subscriptions := map[string][]string{
+		"consumer-a1": {topic},
+		"consumer-a2": {topic},
+		"consumer-b1": {topic},
+	}
+	metadata := map[string][]byte{
+		"consumer-a1": NewRackMemberMetadata("a"),
+		"consumer-a2": NewRackMemberMetadata("a"),
+		"consumer-b1": NewRackMemberMetadata("b"),
+	}
+
+	context := &AssignmentContext{
+		Group:               "rack-aware-group",
+		Members:             []string{"consumer-a1", "consumer-a2", "consumer-b1"},
+		MemberSubscriptions: subscriptions,
+		PartitionsPerTopic:  map[string][]int32{topic: {0, 1, 2}},
+		MemberMetadata:      metadata,
+	}
+
+	assignment := strategy.Assign(context)
+
+	owner := make(map[int32]string)
+	for member, owned := range assignment {
+		for _, tp := range owned {
+			owner[tp.Partition] = member
+		}
+	}
+
+	if owner[2] != "consumer-b1" {
+		t.Errorf("Expected the rack-b partition to be assigned to the rack-b consumer, got %s", owner[2])
+	}
+	if owner[0] != "consumer-a1" && owner[0] != "consumer-a2" {
+		t.Errorf("Expected the rack-a partitions to be assigned to a rack-a consumer, got %s", owner[0])
+	}
+	if owner[1] != "consumer-a1" && owner[1] != "consumer-a2" {
+		t.Errorf("Expected the rack-a partitions to be assigned to a rack-a consumer, got %s", owner[1])
+	}
+}
+
+func TestManualBatchRedeliversUncommittedHalf(t *testing.T) {
+	topic := fmt.Sprintf("test-manual-batch-%d", time.Now().Unix())
+	group := fmt.Sprintf("manual-batch-group-%d", time.Now().Unix())
+	messages := 100
+	halfway := int64(messages / 2)
+
+	CreateMultiplePartitionsTopic(localZk, topic, 1)
+	EnsureHasLeader(localZk, topic)
+	go produceN(t, messages, topic, localBroker)
+
+	processed := 0
+	firstPassDone := make(chan bool)
+
+	config := testConsumerConfig()
+	config.Groupid = group
+	config.OffsetCommitMode = ManualBatch
+	config.FetchBatchSize = 10
+	var consumer *Consumer
+	config.BatchStrategy = func(_ *Worker, batch []*Message, id TaskId) WorkerResult {
+		for _, msg := range batch {
+			//a partition's committed offset is a single watermark, not a set
+			//of per-message acks, so only the first half can be committed by
+			//marking it: the second half is processed but left unmarked, and
+			//CommitOffsets has nothing to advance the watermark past it
+			if msg.Offset < halfway {
+				consumer.MarkOffset(msg, "")
+			}
+			processed++
+		}
+		consumer.CommitOffsets()
+		if processed >= messages {
+			firstPassDone <- true
+		}
+		return NewSuccessfulResult(id)
+	}
+	consumer = NewConsumer(config)
+	go consumer.StartStatic(map[string]int{topic: 1})
+
+	select {
+	case <-firstPassDone:
+	case <-time.After(consumeTimeout):
+		t.Errorf("Failed to process %d messages within %s", messages, consumeTimeout)
+	}
+	closeWithin(t, 10*time.Second, consumer)
+
+	//restart against the same group and make sure the watermark resumes
+	//right after the committed half, redelivering the uncommitted half and
+	//nothing else
+	redelivered := make(map[int64]bool)
+	var redeliveredLock sync.Mutex
+
+	config2 := testConsumerConfig()
+	config2.Groupid = group
+	config2.OffsetCommitMode = ManualBatch
+	config2.FetchBatchSize = 10
+	var consumer2 *Consumer
+	config2.BatchStrategy = func(_ *Worker, batch []*Message, id TaskId) WorkerResult {
+		for _, msg := range batch {
+			consumer2.MarkOffset(msg, "")
+			inLock(&redeliveredLock, func() {
+				redelivered[msg.Offset] = true
+			})
+		}
+		consumer2.CommitOffsets()
+		return NewSuccessfulResult(id)
+	}
+	consumer2 = NewConsumer(config2)
+	go consumer2.StartStatic(map[string]int{topic: 1})
+
+	//give the restarted consumer time to drain whatever was left uncommitted
+	time.Sleep(15 * time.Second)
+
+	for offset := range redelivered {
+		if offset < halfway {
+			t.Errorf("Offset %d was committed but got redelivered", offset)
+		}
+	}
+	if expected := messages - int(halfway); len(redelivered) != expected {
+		t.Errorf("Expected exactly the %d uncommitted messages to be redelivered, got %d", expected, len(redelivered))
+	}
+	closeWithin(t, 10*time.Second, consumer2)
+}
+
 func testConsumerConfig() *ConsumerConfig {
 	config := DefaultConsumerConfig()
 	config.AutoOffsetReset = SmallestOffset
@@ -370,6 +696,7 @@ func testConsumerConfig() *ConsumerConfig {
 		return CommitOffsetAndContinue
 	}
 	config.Strategy = goodStrategy
+	config.BrokerList = []string{localBroker}
 
 	zkConfig := NewZookeeperConfig()
 	zkConfig.ZookeeperConnect = []string{localZk}
@@ -0,0 +1,403 @@
+/* Licensed to the Apache Software Foundation (ASF) under one or more
+contributor license agreements.  See the NOTICE file distributed with
+this work for additional information regarding copyright ownership.
+The ASF licenses this file to You under the Apache License, Version 2.0
+(the "License"); you may not use this file except in compliance with
+the License.  You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License. */
+
+package go_kafka_client
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ConsumerCoordinator is everything a Consumer needs from group membership
+// and offset storage. ZookeeperCoordinator is the only implementation in
+// this tree; it is an interface so tests (and, eventually, alternative
+// coordination backends) can substitute their own.
+type ConsumerCoordinator interface {
+	Connect() error
+	Close() error
+
+	RegisterConsumer(group string, consumerId string, topics []string, metadata []byte) error
+	GetConsumersInGroup(group string) ([]string, error)
+
+	// GetConsumerRegistration reads back what a member of group (including
+	// this one) published via RegisterConsumer: the topics it subscribed to
+	// and its opaque UserData. assignPartitions calls this for every member
+	// returned by GetConsumersInGroup to build an AssignmentContext that
+	// reflects the whole group's subscriptions, not just this consumer's own.
+	GetConsumerRegistration(group string, consumerId string) (topics []string, metadata []byte, err error)
+
+	GetAllTopics() ([]string, error)
+	GetTopicPartitions(topic string) ([]int32, error)
+
+	GetOffset(group string, topic string, partition int32) (int64, error)
+	CommitOffset(group string, topic string, partition int32, offset int64, metadata string) error
+
+	SubscribeForChanges(group string) error
+
+	ReleasePartitionOwnership(group string, consumerId string, partitions []TopicAndPartition) error
+	ClaimPartitionOwnership(group string, consumerId string, partitions []TopicAndPartition) error
+	AwaitPartitionsReleased(group string, partitions []TopicAndPartition, timeout time.Duration) error
+
+	// GetPartitionOwner returns the consumerId that currently owns tp within
+	// group, or "" if nobody does. assignPartitions uses this to build the
+	// previous assignment a PartitionAssignmentStrategy needs to minimize
+	// movement.
+	GetPartitionOwner(group string, tp TopicAndPartition) (string, error)
+
+	GetBrokerRack(brokerId int32) (string, error)
+	GetPartitionLeader(topic string, partition int32) (int32, error)
+
+	RequestBlueGreenDeployment(blue BlueGreenDeployment, green BlueGreenDeployment) error
+}
+
+// ZookeeperConfig configures a ZookeeperCoordinator.
+type ZookeeperConfig struct {
+	ZookeeperConnect []string
+	ZookeeperTimeout time.Duration
+}
+
+// NewZookeeperConfig returns a ZookeeperConfig with the same defaults the
+// rest of the client assumes (a 6 second session timeout) if not overridden.
+func NewZookeeperConfig() *ZookeeperConfig {
+	return &ZookeeperConfig{
+		ZookeeperTimeout: 6 * time.Second,
+	}
+}
+
+// ZookeeperCoordinator is the ConsumerCoordinator backed by a ZooKeeper
+// ensemble, using the same znode layout as the original Scala Kafka
+// high-level consumer (/consumers/<group>/..., /brokers/...).
+type ZookeeperCoordinator struct {
+	config *ZookeeperConfig
+	conn   zkConn
+}
+
+// NewZookeeperCoordinator builds a coordinator for the given configuration.
+// Connect must be called before it is usable.
+func NewZookeeperCoordinator(config *ZookeeperConfig) *ZookeeperCoordinator {
+	return &ZookeeperCoordinator{config: config}
+}
+
+func (z *ZookeeperCoordinator) Connect() error {
+	conn, err := dialZookeeper(z.config.ZookeeperConnect, z.config.ZookeeperTimeout)
+	if err != nil {
+		return err
+	}
+	z.conn = conn
+	return nil
+}
+
+func (z *ZookeeperCoordinator) Close() error {
+	if z.conn == nil {
+		return nil
+	}
+	return z.conn.Close()
+}
+
+// consumerRegistration is the JSON payload written to a member's znode at
+// /consumers/<group>/ids/<consumerId>, matching the registration format the
+// pre-KIP-429 ZooKeeper-based Kafka consumer protocol used: the topics a
+// member subscribes to travel alongside it, so every other member can read
+// the whole group's subscriptions straight out of ZooKeeper during a
+// rebalance instead of needing its own side channel. UserData carries this
+// client's own addition, the opaque GroupMemberMetadata/MetadataFunc bytes a
+// PartitionAssignmentStrategy like RackAwareRangeStrategy reads back out of
+// AssignmentContext.MemberMetadata.
+type consumerRegistration struct {
+	Version      int            `json:"version"`
+	Subscription map[string]int `json:"subscription"`
+	Pattern      string         `json:"pattern"`
+	Timestamp    string         `json:"timestamp"`
+	UserData     string         `json:"userData,omitempty"`
+}
+
+func (z *ZookeeperCoordinator) RegisterConsumer(group string, consumerId string, topics []string, metadata []byte) error {
+	subscription := make(map[string]int, len(topics))
+	for _, topic := range topics {
+		subscription[topic] = 1
+	}
+	registration := consumerRegistration{
+		Version:      1,
+		Subscription: subscription,
+		Pattern:      "static",
+		Timestamp:    strconv.FormatInt(time.Now().UnixNano(), 10),
+	}
+	if len(metadata) > 0 {
+		registration.UserData = base64.StdEncoding.EncodeToString(metadata)
+	}
+	data, err := json.Marshal(registration)
+	if err != nil {
+		return err
+	}
+	path := fmt.Sprintf("/consumers/%s/ids/%s", group, consumerId)
+	return z.conn.EnsureCreated(path, data, true)
+}
+
+func (z *ZookeeperCoordinator) GetConsumerRegistration(group string, consumerId string) ([]string, []byte, error) {
+	path := fmt.Sprintf("/consumers/%s/ids/%s", group, consumerId)
+	data, err := z.conn.Get(path)
+	if err == errZkNoNode {
+		return nil, nil, nil
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var registration consumerRegistration
+	if err := json.Unmarshal(data, &registration); err != nil {
+		return nil, nil, err
+	}
+
+	topics := make([]string, 0, len(registration.Subscription))
+	for topic := range registration.Subscription {
+		topics = append(topics, topic)
+	}
+	sort.Strings(topics)
+
+	var metadata []byte
+	if registration.UserData != "" {
+		metadata, err = base64.StdEncoding.DecodeString(registration.UserData)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+	return topics, metadata, nil
+}
+
+func (z *ZookeeperCoordinator) GetConsumersInGroup(group string) ([]string, error) {
+	return z.conn.Children(fmt.Sprintf("/consumers/%s/ids", group))
+}
+
+func (z *ZookeeperCoordinator) GetAllTopics() ([]string, error) {
+	return z.conn.Children("/brokers/topics")
+}
+
+type topicPartitionState struct {
+	Partitions map[string][]int32 `json:"partitions"`
+}
+
+// GetTopicPartitions returns topic's partition ids, read out of the same
+// /brokers/topics/<topic> znode the original Scala Kafka broker publishes
+// its partition-to-replica map to.
+func (z *ZookeeperCoordinator) GetTopicPartitions(topic string) ([]int32, error) {
+	data, err := z.conn.Get(fmt.Sprintf("/brokers/topics/%s", topic))
+	if err != nil {
+		return nil, err
+	}
+
+	var state topicPartitionState
+	if err := json.Unmarshal(data, &state); err != nil {
+		return nil, err
+	}
+
+	partitions := make([]int32, 0, len(state.Partitions))
+	for idStr := range state.Partitions {
+		id, err := strconv.Atoi(idStr)
+		if err != nil {
+			return nil, err
+		}
+		partitions = append(partitions, int32(id))
+	}
+	sort.Slice(partitions, func(i, j int) bool { return partitions[i] < partitions[j] })
+	return partitions, nil
+}
+
+func (z *ZookeeperCoordinator) offsetPath(group string, topic string, partition int32) string {
+	return fmt.Sprintf("/consumers/%s/offsets/%s/%d", group, topic, partition)
+}
+
+func (z *ZookeeperCoordinator) GetOffset(group string, topic string, partition int32) (int64, error) {
+	data, err := z.conn.Get(z.offsetPath(group, topic, partition))
+	if err == errZkNoNode {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	return parseOffsetData(data)
+}
+
+func (z *ZookeeperCoordinator) CommitOffset(group string, topic string, partition int32, offset int64, metadata string) error {
+	data := []byte(fmt.Sprintf("%d:%s", offset, metadata))
+	return z.conn.EnsureCreated(z.offsetPath(group, topic, partition), data, false)
+}
+
+func parseOffsetData(data []byte) (int64, error) {
+	raw := string(data)
+	if idx := strings.IndexByte(raw, ':'); idx >= 0 {
+		raw = raw[:idx]
+	}
+	if raw == "" {
+		return 0, nil
+	}
+	return strconv.ParseInt(raw, 10, 64)
+}
+
+func (z *ZookeeperCoordinator) SubscribeForChanges(group string) error {
+	// Writes the current time into this group's /consumers/<group>/changes
+	// znode. No member sets a watch on that znode, so writing it does not
+	// by itself make any member re-run its assignment.
+	return z.conn.EnsureCreated(fmt.Sprintf("/consumers/%s/changes", group), []byte(strconv.FormatInt(time.Now().UnixNano(), 10)), false)
+}
+
+func (z *ZookeeperCoordinator) partitionOwnerPath(group string, tp TopicAndPartition) string {
+	return fmt.Sprintf("/consumers/%s/owners/%s/%d", group, tp.Topic, tp.Partition)
+}
+
+func (z *ZookeeperCoordinator) ReleasePartitionOwnership(group string, consumerId string, partitions []TopicAndPartition) error {
+	for _, tp := range partitions {
+		if err := z.conn.Delete(z.partitionOwnerPath(group, tp)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ClaimPartitionOwnership creates each partition's owner znode, failing
+// rather than overwriting it if another consumer already holds it: two
+// members in the same group must never believe they both own the same
+// partition, so a conflicting claim here is a real error a rebalance needs
+// to surface and retry, not something to paper over with an overwrite.
+// Reclaiming a partition this consumerId already owns (e.g. a retry after a
+// partial failure) is treated as success.
+func (z *ZookeeperCoordinator) ClaimPartitionOwnership(group string, consumerId string, partitions []TopicAndPartition) error {
+	for _, tp := range partitions {
+		if err := z.claimPartition(group, consumerId, tp); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (z *ZookeeperCoordinator) claimPartition(group string, consumerId string, tp TopicAndPartition) error {
+	path := z.partitionOwnerPath(group, tp)
+	err := z.conn.Create(path, []byte(consumerId), true)
+	if err == errZkNoNode {
+		// a brand new group or topic has no owners parent znode yet
+		if parentErr := z.conn.EnsureCreated(fmt.Sprintf("/consumers/%s/owners/%s", group, tp.Topic), nil, false); parentErr != nil {
+			return parentErr
+		}
+		err = z.conn.Create(path, []byte(consumerId), true)
+	}
+	if err == nil {
+		return nil
+	}
+	if err != errZkNodeExists {
+		return err
+	}
+
+	owner, getErr := z.conn.Get(path)
+	if getErr != nil {
+		return getErr
+	}
+	if string(owner) == consumerId {
+		return nil
+	}
+	return fmt.Errorf("zk: cannot claim ownership of %s, already owned by %s", tp, owner)
+}
+
+// GetPartitionOwner returns the consumerId currently holding tp's owner
+// znode within group, or "" if nobody does.
+func (z *ZookeeperCoordinator) GetPartitionOwner(group string, tp TopicAndPartition) (string, error) {
+	data, err := z.conn.Get(z.partitionOwnerPath(group, tp))
+	if err == errZkNoNode {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
+
+// AwaitPartitionsReleased polls, until timeout, for every partition in
+// partitions to have no owner znode left, i.e. for every other member that
+// needed to give one of them up to have done so. This is what lets a
+// cooperative rebalance's second (assign) round wait on the first (revoke)
+// round without the coordinator needing to push events itself.
+func (z *ZookeeperCoordinator) AwaitPartitionsReleased(group string, partitions []TopicAndPartition, timeout time.Duration) error {
+	deadline := time.Now().Add(timeout)
+	backoff := 50 * time.Millisecond
+	for {
+		allReleased := true
+		for _, tp := range partitions {
+			owned, err := z.conn.Exists(z.partitionOwnerPath(group, tp))
+			if err != nil {
+				return err
+			}
+			if owned {
+				allReleased = false
+				break
+			}
+		}
+		if allReleased {
+			return nil
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("zk: timed out waiting for partitions to be released by their previous owners")
+		}
+		time.Sleep(backoff)
+	}
+}
+
+type brokerRegistration struct {
+	Rack string `json:"rack"`
+}
+
+func (z *ZookeeperCoordinator) GetBrokerRack(brokerId int32) (string, error) {
+	data, err := z.conn.Get(fmt.Sprintf("/brokers/ids/%d", brokerId))
+	if err != nil {
+		return "", err
+	}
+	var registration brokerRegistration
+	if err := json.Unmarshal(data, &registration); err != nil {
+		return "", err
+	}
+	return registration.Rack, nil
+}
+
+type partitionState struct {
+	Leader int32 `json:"leader"`
+}
+
+func (z *ZookeeperCoordinator) GetPartitionLeader(topic string, partition int32) (int32, error) {
+	path := fmt.Sprintf("/brokers/topics/%s/partitions/%d/state", topic, partition)
+	data, err := z.conn.Get(path)
+	if err != nil {
+		return 0, err
+	}
+	var state partitionState
+	if err := json.Unmarshal(data, &state); err != nil {
+		return 0, err
+	}
+	return state.Leader, nil
+}
+
+func (z *ZookeeperCoordinator) RequestBlueGreenDeployment(blue BlueGreenDeployment, green BlueGreenDeployment) error {
+	request := struct {
+		Blue  BlueGreenDeployment `json:"blue"`
+		Green BlueGreenDeployment `json:"green"`
+	}{blue, green}
+	data, err := json.Marshal(request)
+	if err != nil {
+		return err
+	}
+	path := fmt.Sprintf("/bluegreen/%s-%s-%d", blue.Group, green.Group, time.Now().UnixNano())
+	return z.conn.EnsureCreated(path, data, false)
+}
@@ -0,0 +1,64 @@
+/* Licensed to the Apache Software Foundation (ASF) under one or more
+contributor license agreements.  See the NOTICE file distributed with
+this work for additional information regarding copyright ownership.
+The ASF licenses this file to You under the Apache License, Version 2.0
+(the "License"); you may not use this file except in compliance with
+the License.  You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License. */
+
+package go_kafka_client
+
+import (
+	"fmt"
+	"log"
+)
+
+// tag turns whatever was passed as the first argument to Info/Debug/Warn/etc.
+// into the string that gets printed in front of the log line. Callers pass
+// either a plain string (as in the test helpers) or a *Consumer, so callers
+// don't need to know a consumer's id to log against it.
+func tag(source interface{}) string {
+	if stringer, ok := source.(fmt.Stringer); ok {
+		return stringer.String()
+	}
+	return fmt.Sprint(source)
+}
+
+func Debug(source interface{}, message string) {
+	log.Printf("[DEBUG] %s: %s", tag(source), message)
+}
+
+func Debugf(source interface{}, format string, args ...interface{}) {
+	Debug(source, fmt.Sprintf(format, args...))
+}
+
+func Info(source interface{}, message string) {
+	log.Printf("[INFO] %s: %s", tag(source), message)
+}
+
+func Infof(source interface{}, format string, args ...interface{}) {
+	Info(source, fmt.Sprintf(format, args...))
+}
+
+func Warn(source interface{}, message string) {
+	log.Printf("[WARN] %s: %s", tag(source), message)
+}
+
+func Warnf(source interface{}, format string, args ...interface{}) {
+	Warn(source, fmt.Sprintf(format, args...))
+}
+
+func Error(source interface{}, message string) {
+	log.Printf("[ERROR] %s: %s", tag(source), message)
+}
+
+func Errorf(source interface{}, format string, args ...interface{}) {
+	Error(source, fmt.Sprintf(format, args...))
+}
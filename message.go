@@ -0,0 +1,93 @@
+/* Licensed to the Apache Software Foundation (ASF) under one or more
+contributor license agreements.  See the NOTICE file distributed with
+this work for additional information regarding copyright ownership.
+The ASF licenses this file to You under the Apache License, Version 2.0
+(the "License"); you may not use this file except in compliance with
+the License.  You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License. */
+
+package go_kafka_client
+
+import "fmt"
+
+// Message is a single record delivered to a WorkerStrategy, along with
+// enough information about where it came from to commit an offset for it.
+type Message struct {
+	Key       []byte
+	Value     []byte
+	Topic     string
+	Partition int32
+	Offset    int64
+}
+
+// TaskId identifies one unit of work handed to a Worker.
+type TaskId struct {
+	TaskNumber int64
+	ConsumerId string
+}
+
+func (id TaskId) String() string {
+	return fmt.Sprintf("%s-%d", id.ConsumerId, id.TaskNumber)
+}
+
+// WorkerResult is returned by a WorkerStrategy (or BatchWorkerStrategy) to
+// tell the WorkerManager whether the work succeeded.
+type WorkerResult interface {
+	Success() bool
+}
+
+type workerResult struct {
+	id      TaskId
+	success bool
+}
+
+func (r *workerResult) Success() bool { return r.success }
+
+// NewSuccessfulResult builds the WorkerResult a WorkerStrategy returns once
+// it has finished processing its message (or batch) without error.
+func NewSuccessfulResult(id TaskId) WorkerResult {
+	return &workerResult{id: id, success: true}
+}
+
+// NewProcessingFailedResult builds the WorkerResult a WorkerStrategy returns
+// when it failed to process its message (or batch).
+func NewProcessingFailedResult(id TaskId) WorkerResult {
+	return &workerResult{id: id, success: false}
+}
+
+// FailedDecision tells the WorkerManager how to proceed after a worker
+// reports a failure, either for the manager as a whole (WorkerFailureCallback)
+// or for a single retried task (WorkerFailedAttemptCallback).
+type FailedDecision int
+
+const (
+	CommitOffsetAndContinue FailedDecision = iota
+	DoNotCommitOffsetAndContinue
+	CommitOffsetAndStop
+	DoNotCommitOffsetAndStop
+)
+
+// Task is a single message (or batch) dispatched to a Worker, tracked so it
+// can be retried or reported on failure.
+type Task struct {
+	Id      TaskId
+	Message *Message
+	Batch   []*Message
+}
+
+// WorkerStrategy processes a single Message. It is the default processing
+// mode (ConsumerConfig.OffsetCommitMode == Automatic or Manual).
+type WorkerStrategy func(worker *Worker, msg *Message, id TaskId) WorkerResult
+
+// Worker runs WorkerStrategy (or BatchWorkerStrategy) calls handed to it by
+// the WorkerManager.
+type Worker struct {
+	Id TaskId
+}
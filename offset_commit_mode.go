@@ -0,0 +1,119 @@
+/* Licensed to the Apache Software Foundation (ASF) under one or more
+contributor license agreements.  See the NOTICE file distributed with
+this work for additional information regarding copyright ownership.
+The ASF licenses this file to You under the Apache License, Version 2.0
+(the "License"); you may not use this file except in compliance with
+the License.  You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License. */
+
+package go_kafka_client
+
+import "sync"
+
+// OffsetCommitMode controls when a consumer's offsets are written back to
+// the coordinator.
+type OffsetCommitMode int
+
+const (
+	// Automatic is the default: the WorkerManager commits offsets on its
+	// own cadence as messages are acknowledged, exactly as it always has.
+	Automatic OffsetCommitMode = iota
+
+	// Manual hands the application a single Message at a time (via the
+	// regular WorkerStrategy) but disables the WorkerManager's own commit
+	// cadence; the application must call Consumer.MarkOffset and
+	// Consumer.CommitOffsets itself.
+	Manual
+
+	// ManualBatch delivers messages to a BatchWorkerStrategy in batches of
+	// up to FetchBatchSize (or whatever arrives within FetchBatchTimeout,
+	// whichever comes first) and, like Manual, leaves committing entirely to
+	// the application.
+	ManualBatch
+)
+
+// BatchWorkerStrategy is the batch-mode counterpart of WorkerStrategy: it
+// receives a whole batch of messages at once and returns only after the
+// entire batch has been processed. It is only invoked when
+// ConsumerConfig.OffsetCommitMode is ManualBatch.
+type BatchWorkerStrategy func(worker *Worker, messages []*Message, id TaskId) WorkerResult
+
+// offsetStage accumulates offsets an application has marked via MarkOffset
+// but not yet flushed via CommitOffsets, so CommitOffsets can commit
+// everything staged so far in one shot.
+type offsetStage struct {
+	lock     sync.Mutex
+	staged   map[TopicAndPartition]int64
+	metadata map[TopicAndPartition]string
+}
+
+func newOffsetStage() *offsetStage {
+	return &offsetStage{
+		staged:   make(map[TopicAndPartition]int64),
+		metadata: make(map[TopicAndPartition]string),
+	}
+}
+
+func (s *offsetStage) mark(tp TopicAndPartition, offset int64, metadata string) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.staged[tp] = offset
+	s.metadata[tp] = metadata
+}
+
+// drain removes and returns everything currently staged, so the caller can
+// commit it without racing a concurrent MarkOffset for a later message.
+func (s *offsetStage) drain() (map[TopicAndPartition]int64, map[TopicAndPartition]string) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	staged := s.staged
+	metadata := s.metadata
+	s.staged = make(map[TopicAndPartition]int64)
+	s.metadata = make(map[TopicAndPartition]string)
+	return staged, metadata
+}
+
+// MarkOffset stages the offset just past msg (the next one to read) to be
+// committed on the next call to CommitOffsets, so a restarted consumer
+// resumes after msg. It is only meaningful when ConsumerConfig.OffsetCommitMode
+// is Manual or ManualBatch; in Automatic mode the WorkerManager commits
+// offsets on its own and MarkOffset has no effect.
+func (c *Consumer) MarkOffset(msg *Message, metadata string) {
+	if c.config.OffsetCommitMode == Automatic {
+		return
+	}
+	tp := TopicAndPartition{msg.Topic, msg.Partition}
+	c.offsetStage.mark(tp, msg.Offset+1, metadata)
+}
+
+// CommitOffsets flushes every offset staged via MarkOffset since the last
+// call to CommitOffsets, transactionally from the caller's point of view:
+// either all of them reach the coordinator or none are removed from the
+// stage and a retry will re-send the same set.
+func (c *Consumer) CommitOffsets() error {
+	staged, metadata := c.offsetStage.drain()
+	if len(staged) == 0 {
+		return nil
+	}
+
+	for tp, offset := range staged {
+		if err := c.commitOffset(tp, offset, metadata[tp]); err != nil {
+			// put everything back so a subsequent CommitOffsets retries the
+			// whole batch rather than silently dropping it
+			for failedTp, failedOffset := range staged {
+				c.offsetStage.mark(failedTp, failedOffset, metadata[failedTp])
+			}
+			return err
+		}
+	}
+	return nil
+}
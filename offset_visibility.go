@@ -0,0 +1,115 @@
+/* Licensed to the Apache Software Foundation (ASF) under one or more
+contributor license agreements.  See the NOTICE file distributed with
+this work for additional information regarding copyright ownership.
+The ASF licenses this file to You under the Apache License, Version 2.0
+(the "License"); you may not use this file except in compliance with
+the License.  You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License. */
+
+package go_kafka_client
+
+import (
+	"sync"
+	"time"
+)
+
+// offsetVisibilityBarrier closes a race where a partition is reassigned
+// during a rebalance and its new owner starts fetching before ZooKeeper has
+// observed the previous owner's final commit: the new owner would read a
+// stale committed offset and reprocess messages the previous owner already
+// handled. Before the worker manager is allowed to dispatch messages for a
+// newly assigned partition, the barrier waits for the coordinator's view of
+// the committed offset to catch up to whatever this member itself last wrote
+// for that partition, if anything.
+type offsetVisibilityBarrier struct {
+	lock          sync.Mutex
+	lastCommitted map[TopicAndPartition]int64
+}
+
+func newOffsetVisibilityBarrier() *offsetVisibilityBarrier {
+	return &offsetVisibilityBarrier{
+		lastCommitted: make(map[TopicAndPartition]int64),
+	}
+}
+
+// recordOwnCommit is called every time this member commits an offset, so the
+// barrier knows what value it must see come back from the coordinator the
+// next time it is assigned that partition.
+func (b *offsetVisibilityBarrier) recordOwnCommit(tp TopicAndPartition, offset int64) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	b.lastCommitted[tp] = offset
+}
+
+func (b *offsetVisibilityBarrier) expectedOffset(tp TopicAndPartition) (int64, bool) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	offset, exists := b.lastCommitted[tp]
+	return offset, exists
+}
+
+// awaitOffsetVisible blocks, with backoff bounded by config.OffsetsCommitMaxRetries,
+// until the coordinator reports a committed offset for tp that is at least
+// the one this member previously wrote there. If this member has never
+// previously committed to tp (e.g. it is a brand new assignment), there is
+// nothing to wait for and it returns immediately.
+func (c *Consumer) awaitOffsetVisible(tp TopicAndPartition) error {
+	expected, hadPriorCommit := c.offsetBarrier.expectedOffset(tp)
+	if !hadPriorCommit {
+		return nil
+	}
+
+	backoff := 100 * time.Millisecond
+	var lastErr error
+	for attempt := 0; attempt < c.config.OffsetsCommitMaxRetries; attempt++ {
+		committed, err := c.config.Coordinator.GetOffset(c.config.Groupid, tp.Topic, tp.Partition)
+		if err != nil {
+			lastErr = err
+			Warnf(c, "Failed to read committed offset for %s while awaiting visibility (attempt %d/%d): %s", tp, attempt+1, c.config.OffsetsCommitMaxRetries, err)
+			time.Sleep(backoff)
+			backoff *= 2
+			continue
+		}
+		lastErr = nil
+		if committed >= expected {
+			return nil
+		}
+
+		Infof(c, "Committed offset for %s not yet visible (want >= %d, saw %d), waiting before starting consumption", tp, expected, committed)
+		time.Sleep(backoff)
+		backoff *= 2
+	}
+
+	if lastErr != nil {
+		return lastErr
+	}
+	Warnf(c, "Gave up waiting for committed offset visibility on %s after %d attempts; starting consumption anyway", tp, c.config.OffsetsCommitMaxRetries)
+	return nil
+}
+
+// awaitAssignedPartitionsVisible runs awaitOffsetVisible, in parallel, for
+// every partition in assigned, whether kept or newly assigned, before their
+// fetchers are started. rebalanceAndConsume calls this
+// immediately after a rebalance completes and before fetchers are started.
+func (c *Consumer) awaitAssignedPartitionsVisible(assigned []TopicAndPartition) {
+	var wait sync.WaitGroup
+	for _, tp := range assigned {
+		wait.Add(1)
+		go func(tp TopicAndPartition) {
+			defer wait.Done()
+			if err := c.awaitOffsetVisible(tp); err != nil {
+				Errorf(c, "Giving up on offset-visibility check for %s, starting consumption anyway: %s", tp, err)
+			}
+		}(tp)
+	}
+	wait.Wait()
+}
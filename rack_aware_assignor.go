@@ -0,0 +1,160 @@
+/* Licensed to the Apache Software Foundation (ASF) under one or more
+contributor license agreements.  See the NOTICE file distributed with
+this work for additional information regarding copyright ownership.
+The ASF licenses this file to You under the Apache License, Version 2.0
+(the "License"); you may not use this file except in compliance with
+the License.  You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License. */
+
+package go_kafka_client
+
+import "sort"
+
+// RackAwareRangeStrategy is a reference PartitionAssignmentStrategy that
+// prefers assigning a partition to a consumer whose rack matches the rack of
+// the partition's leader replica, falling back to the least-loaded
+// subscriber (still under its even share of the topic) whenever rack
+// information is missing or no rack-local consumer is available. A member's
+// rack is read out of the "rack" key of its AssignmentContext.MemberMetadata
+// blob (see NewRackMemberMetadata); a broker's rack comes from BrokerRacks
+// and a partition's leader from PartitionLeaders. The strategy does not
+// fill either map itself: the caller sets them, e.g. from the coordinator's
+// GetBrokerRack (which reads /brokers/ids/N in ZooKeeper) and
+// GetPartitionLeader.
+type RackAwareRangeStrategy struct {
+	// BrokerRacks maps a broker id to the rack it was registered with.
+	BrokerRacks map[int32]string
+
+	// PartitionLeaders maps a topic-partition to the broker id currently
+	// leading it.
+	PartitionLeaders map[TopicAndPartition]int32
+}
+
+func (*RackAwareRangeStrategy) Name() string { return "rack-aware-range" }
+
+func (s *RackAwareRangeStrategy) Assign(context *AssignmentContext) map[string][]TopicAndPartition {
+	assignment := make(map[string][]TopicAndPartition)
+	for _, member := range context.Members {
+		assignment[member] = make([]TopicAndPartition, 0)
+	}
+
+	memberRack := make(map[string]string)
+	for member, metadata := range context.MemberMetadata {
+		if rack, exists := ParseRackMemberMetadata(metadata); exists {
+			memberRack[member] = rack
+		}
+	}
+
+	for topic, partitions := range context.PartitionsPerTopic {
+		subscribers := membersSubscribedTo(context, topic)
+		if len(subscribers) == 0 {
+			continue
+		}
+		sort.Strings(subscribers)
+
+		sortedPartitions := make([]int32, len(partitions))
+		copy(sortedPartitions, partitions)
+		sort.Slice(sortedPartitions, func(i, j int) bool { return sortedPartitions[i] < sortedPartitions[j] })
+
+		capacity := evenCapacity(sortedPartitions, subscribers)
+		// the share is per topic, but loads count every topic assigned so far
+		for _, member := range subscribers {
+			capacity[member] += len(assignment[member])
+		}
+
+		for _, partition := range sortedPartitions {
+			tp := TopicAndPartition{topic, partition}
+			member := s.pickRackLocalMember(tp, subscribers, memberRack, assignment, capacity)
+			if member == "" {
+				member = leastLoadedOf(subscribers, assignment, capacity)
+			}
+			if member == "" {
+				continue
+			}
+			assignment[member] = append(assignment[member], tp)
+		}
+	}
+	return assignment
+}
+
+// pickRackLocalMember returns the least-loaded subscriber, still under its
+// capacity, whose rack matches the leader replica's rack for tp. It returns
+// "" if the leader's rack is unknown or no matching, eligible member exists.
+func (s *RackAwareRangeStrategy) pickRackLocalMember(tp TopicAndPartition, subscribers []string, memberRack map[string]string, assignment map[string][]TopicAndPartition, capacity map[string]int) string {
+	leader, exists := s.PartitionLeaders[tp]
+	if !exists {
+		return ""
+	}
+	leaderRack, exists := s.BrokerRacks[leader]
+	if !exists {
+		return ""
+	}
+
+	localMembers := make([]string, 0)
+	for _, member := range subscribers {
+		if memberRack[member] == leaderRack {
+			localMembers = append(localMembers, member)
+		}
+	}
+	return leastLoadedOf(localMembers, assignment, capacity)
+}
+
+func leastLoadedOf(candidates []string, assignment map[string][]TopicAndPartition, capacity map[string]int) string {
+	best := ""
+	bestLoad := -1
+	for _, member := range candidates {
+		if len(assignment[member]) >= capacity[member] {
+			continue
+		}
+		if bestLoad == -1 || len(assignment[member]) < bestLoad {
+			best = member
+			bestLoad = len(assignment[member])
+		}
+	}
+	return best
+}
+
+// evenCapacity divides len(partitions) as evenly as possible across
+// members, handing the remainder to the first members in sorted order.
+func evenCapacity(partitions []int32, members []string) map[string]int {
+	capacity := make(map[string]int)
+	if len(members) == 0 {
+		return capacity
+	}
+	perMember := len(partitions) / len(members)
+	extra := len(partitions) % len(members)
+	for i, member := range members {
+		capacity[member] = perMember
+		if i < extra {
+			capacity[member]++
+		}
+	}
+	return capacity
+}
+
+const rackMetadataKey = "rack"
+
+// NewRackMemberMetadata builds the UserData blob a consumer should publish
+// via ConsumerConfig.GroupMemberMetadata (or MetadataFunc) to advertise its
+// rack id to the group leader.
+func NewRackMemberMetadata(rack string) []byte {
+	return []byte(rackMetadataKey + "=" + rack)
+}
+
+// ParseRackMemberMetadata extracts the rack id previously encoded by
+// NewRackMemberMetadata, if present.
+func ParseRackMemberMetadata(metadata []byte) (string, bool) {
+	prefix := rackMetadataKey + "="
+	value := string(metadata)
+	if len(value) <= len(prefix) || value[:len(prefix)] != prefix {
+		return "", false
+	}
+	return value[len(prefix):], true
+}
@@ -0,0 +1,153 @@
+/* Licensed to the Apache Software Foundation (ASF) under one or more
+contributor license agreements.  See the NOTICE file distributed with
+this work for additional information regarding copyright ownership.
+The ASF licenses this file to You under the Apache License, Version 2.0
+(the "License"); you may not use this file except in compliance with
+the License.  You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License. */
+
+package go_kafka_client
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Shopify/sarama"
+)
+
+// CreateMultiplePartitionsTopic publishes a /brokers/topics/<topic> znode
+// with the given number of partitions, the same znode the original Scala
+// Kafka broker watches for and picks up to create the topic's local logs.
+// It assumes a single-broker test cluster with broker.id=0.
+func CreateMultiplePartitionsTopic(zookeeperConnect string, topic string, partitions int) {
+	conn, err := dialZookeeper([]string{zookeeperConnect}, 10*time.Second)
+	if err != nil {
+		panic(fmt.Sprintf("test helper: failed to connect to %s: %s", zookeeperConnect, err))
+	}
+	defer conn.Close()
+
+	replicas := make(map[string][]int32, partitions)
+	for partition := 0; partition < partitions; partition++ {
+		replicas[fmt.Sprintf("%d", partition)] = []int32{0}
+	}
+	data, err := json.Marshal(topicPartitionState{Partitions: replicas})
+	if err != nil {
+		panic(err)
+	}
+	if err := conn.EnsureCreated(fmt.Sprintf("/brokers/topics/%s", topic), data, false); err != nil {
+		panic(fmt.Sprintf("test helper: failed to create topic %s: %s", topic, err))
+	}
+}
+
+// EnsureHasLeader blocks until every partition of topic has a leader
+// published in ZooKeeper, i.e. until the broker has finished picking up the
+// topic CreateMultiplePartitionsTopic just created.
+func EnsureHasLeader(zookeeperConnect string, topic string) {
+	conn, err := dialZookeeper([]string{zookeeperConnect}, 10*time.Second)
+	if err != nil {
+		panic(fmt.Sprintf("test helper: failed to connect to %s: %s", zookeeperConnect, err))
+	}
+	defer conn.Close()
+
+	deadline := time.Now().Add(30 * time.Second)
+	for time.Now().Before(deadline) {
+		data, err := conn.Get(fmt.Sprintf("/brokers/topics/%s", topic))
+		if err == nil {
+			var state topicPartitionState
+			if json.Unmarshal(data, &state) == nil && len(state.Partitions) > 0 {
+				allElected := true
+				for partition := range state.Partitions {
+					if _, err := conn.Get(fmt.Sprintf("/brokers/topics/%s/partitions/%s/state", topic, partition)); err != nil {
+						allElected = false
+						break
+					}
+				}
+				if allElected {
+					return
+				}
+			}
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	panic(fmt.Sprintf("test helper: topic %s never got a leader", topic))
+}
+
+// produce sends messages to topic on broker, one sarama message per string,
+// using the given compression codec.
+func produce(t *testing.T, messages []string, topic string, broker string, codec sarama.CompressionCodec) {
+	config := sarama.NewConfig()
+	config.Producer.Return.Successes = true
+	config.Producer.Compression = codec
+	producer, err := sarama.NewSyncProducer([]string{broker}, config)
+	if err != nil {
+		t.Fatalf("test helper: failed to connect producer to %s: %s", broker, err)
+	}
+	defer producer.Close()
+
+	for _, message := range messages {
+		_, _, err := producer.SendMessage(&sarama.ProducerMessage{
+			Topic: topic,
+			Value: sarama.StringEncoder(message),
+		})
+		if err != nil {
+			t.Fatalf("test helper: failed to produce to %s: %s", topic, err)
+		}
+	}
+}
+
+// produceN produces n numbered messages to topic on broker.
+func produceN(t *testing.T, n int, topic string, broker string) {
+	messages := make([]string, 0, n)
+	for i := 0; i < n; i++ {
+		messages = append(messages, fmt.Sprintf("test-message-%d", i))
+	}
+	produce(t, messages, topic, broker, sarama.CompressionNone)
+}
+
+// closeWithin closes consumer and fails the test if that doesn't finish
+// within timeout.
+func closeWithin(t *testing.T, timeout time.Duration, consumer *Consumer) {
+	done := make(chan error, 1)
+	go func() {
+		done <- consumer.Close()
+	}()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("Failed to close consumer: %s", err)
+		}
+	case <-time.After(timeout):
+		t.Errorf("Consumer failed to close within %s", timeout)
+	}
+}
+
+// inLock runs fn while holding lock.
+func inLock(lock *sync.Mutex, fn func()) {
+	lock.Lock()
+	defer lock.Unlock()
+	fn()
+}
+
+// assert fails the test if actual and expected aren't equal.
+func assert(t *testing.T, actual interface{}, expected interface{}) {
+	if !reflect.DeepEqual(actual, expected) {
+		t.Errorf("Expected %v, actual %v", expected, actual)
+	}
+}
+
+// goodStrategy is a WorkerStrategy used by tests that don't care about
+// per-message behavior and just want messages acknowledged successfully.
+func goodStrategy(_ *Worker, _ *Message, id TaskId) WorkerResult {
+	return NewSuccessfulResult(id)
+}
@@ -0,0 +1,125 @@
+/* Licensed to the Apache Software Foundation (ASF) under one or more
+contributor license agreements.  See the NOTICE file distributed with
+this work for additional information regarding copyright ownership.
+The ASF licenses this file to You under the Apache License, Version 2.0
+(the "License"); you may not use this file except in compliance with
+the License.  You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License. */
+
+package go_kafka_client
+
+import (
+	"reflect"
+	"sort"
+	"time"
+)
+
+// topicMetadataPoller periodically re-resolves a TopicFilter (a whitelist or
+// blacklist) against the topics that currently exist in ZooKeeper and joins
+// or leaves any topics whose match changed, without requiring the consumer
+// to be restarted. It is only started by StartWildcard; StartStatic consumes
+// a fixed topic set and has no need for it.
+type topicMetadataPoller struct {
+	consumer *Consumer
+	filter   TopicFilter
+	interval time.Duration
+	stopChan chan bool
+}
+
+func newTopicMetadataPoller(consumer *Consumer, filter TopicFilter) *topicMetadataPoller {
+	interval := consumer.config.TopicMetadataRefreshInterval
+	if interval <= 0 {
+		interval = 1 * time.Minute
+	}
+	return &topicMetadataPoller{
+		consumer: consumer,
+		filter:   filter,
+		interval: interval,
+		stopChan: make(chan bool),
+	}
+}
+
+// Start runs the poll loop until Stop is called. It is meant to be run in
+// its own goroutine.
+func (p *topicMetadataPoller) Start() {
+	Infof(p.consumer, "Starting topic metadata poller with refresh interval %s", p.interval)
+	currentTopics := p.resolve()
+
+	for {
+		select {
+		case <-p.stopChan:
+			Info(p.consumer, "Stopping topic metadata poller")
+			return
+		case <-time.After(p.interval):
+			resolved := p.resolve()
+			if topicsChanged(currentTopics, resolved) {
+				Infof(p.consumer, "Topic metadata changed: was %v, now %v", currentTopics, resolved)
+				currentTopics = resolved
+				p.consumer.rebalanceTopics(resolved)
+			}
+		}
+	}
+}
+
+// Stop terminates the poll loop. It does not block waiting for an in-flight
+// poll to finish.
+func (p *topicMetadataPoller) Stop() {
+	close(p.stopChan)
+}
+
+// resolve lists every topic known to ZooKeeper and returns the subset that
+// currently matches p.filter, sorted for stable comparison.
+func (p *topicMetadataPoller) resolve() []string {
+	allTopics, err := p.consumer.config.Coordinator.GetAllTopics()
+	if err != nil {
+		Errorf(p.consumer, "Failed to list topics while polling for metadata changes: %s", err)
+		return nil
+	}
+
+	matching := make([]string, 0)
+	for _, topic := range allTopics {
+		if p.filter.TopicAllowed(topic, p.consumer.config.ExcludeInternalTopics) {
+			matching = append(matching, topic)
+		}
+	}
+	sort.Strings(matching)
+	return matching
+}
+
+func topicsChanged(before []string, after []string) bool {
+	return !reflect.DeepEqual(before, after)
+}
+
+// rebalanceTopics updates the consumer's subscribed topic set, republishes
+// its registration, writes the group's change znode, and re-runs this
+// consumer's own assignment so newly-matching topics are joined and removed
+// ones are dropped. Other members of the group are not notified and do not
+// re-run their assignment.
+func (c *Consumer) rebalanceTopics(topics []string) {
+	c.topicRegistryLock.Lock()
+	c.subscribedTopics = topics
+	c.topicRegistryLock.Unlock()
+
+	if err := c.config.Coordinator.RegisterConsumer(c.config.Groupid, c.config.Consumerid, topics, c.config.memberMetadata()); err != nil {
+		Errorf(c, "Failed to update this consumer's subscription: %s", err)
+	}
+	if err := c.config.Coordinator.SubscribeForChanges(c.config.Groupid); err != nil {
+		Errorf(c, "Failed to notify the group of a topic subscription change: %s", err)
+	}
+
+	assigned, err := c.assignPartitions()
+	if err != nil {
+		Errorf(c, "Failed to rebalance after a topic metadata change: %s", err)
+		return
+	}
+	c.awaitAssignedPartitionsVisible(assigned)
+	c.startFetchersFor(assigned)
+	c.stopFetchersNotIn(assigned)
+}
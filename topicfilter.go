@@ -0,0 +1,81 @@
+/* Licensed to the Apache Software Foundation (ASF) under one or more
+contributor license agreements.  See the NOTICE file distributed with
+this work for additional information regarding copyright ownership.
+The ASF licenses this file to You under the Apache License, Version 2.0
+(the "License"); you may not use this file except in compliance with
+the License.  You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License. */
+
+package go_kafka_client
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// TopicFilter decides whether a topic belongs to a wildcard consumer's
+// subscription, used by both Consumer.StartWildcard and the topic metadata
+// poller that keeps that subscription up to date.
+type TopicFilter interface {
+	TopicAllowed(topic string, excludeInternalTopics bool) bool
+	String() string
+}
+
+// Whitelist matches any topic whose name matches its regular expression.
+type Whitelist struct {
+	raw     string
+	pattern *regexp.Regexp
+}
+
+// NewWhiteList compiles a regular expression into a TopicFilter that allows
+// only topics matching it.
+func NewWhiteList(pattern string) TopicFilter {
+	return &Whitelist{raw: pattern, pattern: regexp.MustCompile(pattern)}
+}
+
+func (w *Whitelist) TopicAllowed(topic string, excludeInternalTopics bool) bool {
+	if excludeInternalTopics && isInternalTopic(topic) {
+		return false
+	}
+	return w.pattern.MatchString(topic)
+}
+
+func (w *Whitelist) String() string {
+	return fmt.Sprintf("Whitelist(%s)", w.raw)
+}
+
+// Blacklist matches any topic whose name does not match its regular
+// expression.
+type Blacklist struct {
+	raw     string
+	pattern *regexp.Regexp
+}
+
+// NewBlackList compiles a regular expression into a TopicFilter that allows
+// every topic except those matching it.
+func NewBlackList(pattern string) TopicFilter {
+	return &Blacklist{raw: pattern, pattern: regexp.MustCompile(pattern)}
+}
+
+func (b *Blacklist) TopicAllowed(topic string, excludeInternalTopics bool) bool {
+	if excludeInternalTopics && isInternalTopic(topic) {
+		return false
+	}
+	return !b.pattern.MatchString(topic)
+}
+
+func (b *Blacklist) String() string {
+	return fmt.Sprintf("Blacklist(%s)", b.raw)
+}
+
+func isInternalTopic(topic string) bool {
+	return strings.HasPrefix(topic, "__")
+}
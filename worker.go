@@ -0,0 +1,142 @@
+/* Licensed to the Apache Software Foundation (ASF) under one or more
+contributor license agreements.  See the NOTICE file distributed with
+this work for additional information regarding copyright ownership.
+The ASF licenses this file to You under the Apache License, Version 2.0
+(the "License"); you may not use this file except in compliance with
+the License.  You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License. */
+
+package go_kafka_client
+
+import "sync"
+
+// WorkerManager owns the pool of Workers for a single consumer and decides,
+// through ConsumerConfig's WorkerFailureCallback/WorkerFailedAttemptCallback,
+// what happens when processing a message fails.
+type WorkerManager struct {
+	consumer *Consumer
+	config   *ConsumerConfig
+
+	taskChan chan *Task
+	stopChan chan bool
+	stopOnce sync.Once
+}
+
+func newWorkerManager(consumer *Consumer) *WorkerManager {
+	return &WorkerManager{
+		consumer: consumer,
+		config:   consumer.config,
+		taskChan: make(chan *Task, consumer.config.NumWorkers),
+		stopChan: make(chan bool),
+	}
+}
+
+// Start launches NumWorkers goroutines draining taskChan. It is meant to be
+// called once per Consumer, from StartStatic/StartWildcard.
+func (wm *WorkerManager) Start() {
+	for i := 0; i < wm.config.NumWorkers; i++ {
+		id := TaskId{TaskNumber: int64(i), ConsumerId: wm.config.Consumerid}
+		go wm.runWorker(&Worker{Id: id})
+	}
+}
+
+// Stop terminates every worker goroutine. It does not wait for in-flight
+// tasks to drain.
+func (wm *WorkerManager) Stop() {
+	wm.stopOnce.Do(func() {
+		close(wm.stopChan)
+	})
+}
+
+// dispatch hands a single message to the worker pool. Callers (the fetchers)
+// block once NumWorkers tasks are already queued and waiting for a worker,
+// which is the natural form of backpressure for this consumer.
+func (wm *WorkerManager) dispatch(msg *Message) {
+	wm.taskChan <- &Task{Id: TaskId{ConsumerId: wm.config.Consumerid}, Message: msg}
+}
+
+// dispatchBatch hands an entire fetched batch to the worker pool at once.
+// It is only used when ConsumerConfig.OffsetCommitMode is ManualBatch.
+func (wm *WorkerManager) dispatchBatch(batch []*Message) {
+	wm.taskChan <- &Task{Id: TaskId{ConsumerId: wm.config.Consumerid}, Batch: batch}
+}
+
+func (wm *WorkerManager) runWorker(worker *Worker) {
+	for {
+		select {
+		case <-wm.stopChan:
+			return
+		case task := <-wm.taskChan:
+			wm.process(worker, task)
+		}
+	}
+}
+
+func (wm *WorkerManager) process(worker *Worker, task *Task) {
+	var result WorkerResult
+	if task.Batch != nil {
+		result = wm.config.BatchStrategy(worker, task.Batch, task.Id)
+	} else {
+		result = wm.config.Strategy(worker, task.Message, task.Id)
+	}
+
+	if result == nil || result.Success() {
+		wm.onSuccess(task)
+		return
+	}
+
+	decision := CommitOffsetAndContinue
+	if wm.config.WorkerFailedAttemptCallback != nil {
+		decision = wm.config.WorkerFailedAttemptCallback(task, result)
+	} else if wm.config.WorkerFailureCallback != nil {
+		decision = wm.config.WorkerFailureCallback(wm)
+	}
+	wm.applyFailedDecision(task, decision)
+}
+
+// onSuccess commits the offset(s) a task covers when the consumer is in
+// Automatic commit mode. In Manual/ManualBatch mode the application commits
+// for itself via Consumer.MarkOffset/CommitOffsets, so the manager leaves
+// offsets alone here.
+func (wm *WorkerManager) onSuccess(task *Task) {
+	if wm.config.OffsetCommitMode != Automatic {
+		return
+	}
+
+	if task.Message != nil {
+		wm.commitAutomatically(task.Message)
+		return
+	}
+	for _, msg := range task.Batch {
+		wm.commitAutomatically(msg)
+	}
+}
+
+func (wm *WorkerManager) commitAutomatically(msg *Message) {
+	tp := TopicAndPartition{msg.Topic, msg.Partition}
+	// commit the next offset to read, so a restart resumes after msg
+	if err := wm.consumer.commitOffset(tp, msg.Offset+1, ""); err != nil {
+		Errorf(wm.consumer, "Failed to automatically commit offset for %s-%d: %s", msg.Topic, msg.Partition, err)
+	}
+}
+
+func (wm *WorkerManager) applyFailedDecision(task *Task, decision FailedDecision) {
+	switch decision {
+	case CommitOffsetAndContinue:
+		wm.onSuccess(task)
+	case CommitOffsetAndStop:
+		wm.onSuccess(task)
+		wm.Stop()
+	case DoNotCommitOffsetAndStop:
+		wm.Stop()
+	case DoNotCommitOffsetAndContinue:
+		// leave the offset uncommitted and keep processing subsequent tasks
+	}
+}
@@ -0,0 +1,420 @@
+/* Licensed to the Apache Software Foundation (ASF) under one or more
+contributor license agreements.  See the NOTICE file distributed with
+this work for additional information regarding copyright ownership.
+The ASF licenses this file to You under the Apache License, Version 2.0
+(the "License"); you may not use this file except in compliance with
+the License.  You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License. */
+
+package go_kafka_client
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// zkConn is the minimal set of ZooKeeper operations ZookeeperCoordinator
+// needs. It is implemented by zkClient below; tests that don't have a real
+// ensemble available can swap in a fake.
+type zkConn interface {
+	Get(path string) ([]byte, error)
+	Set(path string, data []byte) error
+	Create(path string, data []byte, ephemeral bool) error
+	EnsureCreated(path string, data []byte, ephemeral bool) error
+	Delete(path string) error
+	Exists(path string) (bool, error)
+	Children(path string) ([]string, error)
+	Close() error
+}
+
+const (
+	zkOpNotification = 0
+	zkOpCreate       = 1
+	zkOpDelete       = 2
+	zkOpExists       = 3
+	zkOpGetData      = 4
+	zkOpSetData      = 5
+	zkOpGetChildren  = 8
+	zkOpPing         = 11
+)
+
+var errZkNoNode = errors.New("zk: node does not exist")
+var errZkNodeExists = errors.New("zk: node already exists")
+
+// zkClient is a small, dependency-free client for the subset of the
+// ZooKeeper wire protocol the coordinator relies on: create/delete/exists/
+// getData/setData/getChildren and the session keep-alive ping. It exists so
+// this package does not have to take on an external ZooKeeper client
+// dependency for what is a handful of simple CRUD calls.
+type zkClient struct {
+	conn      net.Conn
+	sessionId int64
+	passwd    []byte
+	timeout   time.Duration
+
+	writeLock sync.Mutex
+	xid       int32
+
+	stopPing chan bool
+}
+
+func dialZookeeper(servers []string, sessionTimeout time.Duration) (*zkClient, error) {
+	if len(servers) == 0 {
+		return nil, errors.New("zk: no servers configured")
+	}
+
+	var lastErr error
+	for _, server := range servers {
+		conn, err := net.DialTimeout("tcp", server, sessionTimeout)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+
+		client := &zkClient{conn: conn, timeout: sessionTimeout, stopPing: make(chan bool)}
+		if err := client.connect(sessionTimeout); err != nil {
+			conn.Close()
+			lastErr = err
+			continue
+		}
+		go client.keepAlive()
+		return client, nil
+	}
+	return nil, fmt.Errorf("zk: could not connect to any server: %s", lastErr)
+}
+
+func (c *zkClient) connect(sessionTimeout time.Duration) error {
+	buf := newJuteWriter()
+	buf.writeInt32(0)                                        // protocolVersion
+	buf.writeInt64(0)                                        // lastZxidSeen
+	buf.writeInt32(int32(sessionTimeout / time.Millisecond)) // timeOut
+	buf.writeInt64(0)                                        // sessionId
+	buf.writeBuffer(nil)                                     // passwd
+
+	if err := c.writeFramed(buf.bytes()); err != nil {
+		return err
+	}
+
+	payload, err := c.readFramed()
+	if err != nil {
+		return err
+	}
+	r := newJuteReader(payload)
+	r.readInt32() // protocolVersion
+	r.readInt32() // timeOut
+	c.sessionId = r.readInt64()
+	c.passwd = r.readBuffer()
+	return r.err
+}
+
+func (c *zkClient) keepAlive() {
+	interval := c.timeout / 3
+	if interval <= 0 {
+		interval = time.Second
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-c.stopPing:
+			return
+		case <-ticker.C:
+			c.request(zkOpPing, nil, nil)
+		}
+	}
+}
+
+// request sends one request of the given opcode with a pre-serialized body
+// and, if parseResponse is non-nil, calls it to parse the response. It returns
+// errZkNoNode when the server reports the path does not exist.
+func (c *zkClient) request(opcode int32, body []byte, parseResponse func(*juteReader)) error {
+	c.writeLock.Lock()
+	xid := atomic.AddInt32(&c.xid, 1)
+	req := newJuteWriter()
+	req.writeInt32(xid)
+	req.writeInt32(opcode)
+	req.raw(body)
+	err := c.writeFramed(req.bytes())
+	c.writeLock.Unlock()
+	if err != nil {
+		return err
+	}
+
+	payload, err := c.readFramed()
+	if err != nil {
+		return err
+	}
+	r := newJuteReader(payload)
+	r.readInt32() // xid
+	r.readInt64() // zxid
+	zkErr := r.readInt32()
+	if zkErr != 0 {
+		switch zkErr {
+		case -101: // NONODE
+			return errZkNoNode
+		case -110: // NODEEXISTS
+			return errZkNodeExists
+		}
+		return fmt.Errorf("zk: request failed with error code %d", zkErr)
+	}
+	if parseResponse != nil {
+		parseResponse(r)
+	}
+	return r.err
+}
+
+func (c *zkClient) Get(path string) ([]byte, error) {
+	req := newJuteWriter()
+	req.writeString(path)
+	req.writeBool(false)
+
+	var data []byte
+	err := c.request(zkOpGetData, req.bytes(), func(r *juteReader) {
+		data = r.readBuffer()
+		r.skip(statSize)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+func (c *zkClient) Set(path string, data []byte) error {
+	req := newJuteWriter()
+	req.writeString(path)
+	req.writeBuffer(data)
+	req.writeInt32(-1) // version: always match
+
+	return c.request(zkOpSetData, req.bytes(), func(r *juteReader) {
+		r.skip(statSize)
+	})
+}
+
+func (c *zkClient) Create(path string, data []byte, ephemeral bool) error {
+	req := newJuteWriter()
+	req.writeString(path)
+	req.writeBuffer(data)
+	req.writeInt32(1)    // ACL count
+	req.writeInt32(0x1f) // perms: ALL
+	req.writeString("world")
+	req.writeString("anyone")
+	flags := int32(0)
+	if ephemeral {
+		flags = 1
+	}
+	req.writeInt32(flags)
+
+	return c.request(zkOpCreate, req.bytes(), func(r *juteReader) {
+		r.readString()
+	})
+}
+
+// EnsureCreated creates path (and any missing parents, as persistent empty
+// znodes) if it does not already exist, and overwrites its data with data if
+// it does. ZookeeperCoordinator uses this for registration znodes that may
+// already be present from a previous session.
+func (c *zkClient) EnsureCreated(path string, data []byte, ephemeral bool) error {
+	err := c.Create(path, data, ephemeral)
+	if err == errZkNoNode {
+		if idx := strings.LastIndex(path, "/"); idx > 0 {
+			if parentErr := c.EnsureCreated(path[:idx], nil, false); parentErr != nil {
+				return parentErr
+			}
+			err = c.Create(path, data, ephemeral)
+		}
+	}
+	if err == nil {
+		return nil
+	}
+	exists, existsErr := c.Exists(path)
+	if existsErr == nil && exists {
+		return c.Set(path, data)
+	}
+	return err
+}
+
+func (c *zkClient) Delete(path string) error {
+	req := newJuteWriter()
+	req.writeString(path)
+	req.writeInt32(-1)
+
+	err := c.request(zkOpDelete, req.bytes(), nil)
+	if err == errZkNoNode {
+		return nil
+	}
+	return err
+}
+
+func (c *zkClient) Exists(path string) (bool, error) {
+	req := newJuteWriter()
+	req.writeString(path)
+	req.writeBool(false)
+
+	err := c.request(zkOpExists, req.bytes(), func(r *juteReader) {
+		r.skip(statSize)
+	})
+	if err == errZkNoNode {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+func (c *zkClient) Children(path string) ([]string, error) {
+	req := newJuteWriter()
+	req.writeString(path)
+	req.writeBool(false)
+
+	var children []string
+	err := c.request(zkOpGetChildren, req.bytes(), func(r *juteReader) {
+		count := r.readInt32()
+		children = make([]string, 0, count)
+		for i := int32(0); i < count; i++ {
+			children = append(children, r.readString())
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	return children, nil
+}
+
+func (c *zkClient) Close() error {
+	close(c.stopPing)
+	return c.conn.Close()
+}
+
+func (c *zkClient) writeFramed(payload []byte) error {
+	lengthPrefix := make([]byte, 4)
+	binary.BigEndian.PutUint32(lengthPrefix, uint32(len(payload)))
+	if _, err := c.conn.Write(lengthPrefix); err != nil {
+		return err
+	}
+	_, err := c.conn.Write(payload)
+	return err
+}
+
+func (c *zkClient) readFramed() ([]byte, error) {
+	lengthPrefix := make([]byte, 4)
+	if _, err := io.ReadFull(c.conn, lengthPrefix); err != nil {
+		return nil, err
+	}
+	length := binary.BigEndian.Uint32(lengthPrefix)
+	payload := make([]byte, length)
+	if _, err := io.ReadFull(c.conn, payload); err != nil {
+		return nil, err
+	}
+	return payload, nil
+}
+
+// statSize is the wire size, in bytes, of a ZooKeeper Stat record (6 int64
+// fields and 5 int32 fields). Callers that don't need the stat just skip it.
+const statSize = 6*8 + 5*4
+
+// --- minimal Jute (ZooKeeper's serialization format) helpers ---
+
+type juteWriter struct {
+	buf []byte
+}
+
+func newJuteWriter() *juteWriter {
+	return &juteWriter{buf: make([]byte, 0, 64)}
+}
+
+func (w *juteWriter) raw(b []byte) { w.buf = append(w.buf, b...) }
+
+func (w *juteWriter) writeInt32(v int32) {
+	b := make([]byte, 4)
+	binary.BigEndian.PutUint32(b, uint32(v))
+	w.buf = append(w.buf, b...)
+}
+
+func (w *juteWriter) writeInt64(v int64) {
+	b := make([]byte, 8)
+	binary.BigEndian.PutUint64(b, uint64(v))
+	w.buf = append(w.buf, b...)
+}
+
+func (w *juteWriter) writeBool(v bool) {
+	if v {
+		w.buf = append(w.buf, 1)
+	} else {
+		w.buf = append(w.buf, 0)
+	}
+}
+
+func (w *juteWriter) writeBuffer(v []byte) {
+	if v == nil {
+		w.writeInt32(-1)
+		return
+	}
+	w.writeInt32(int32(len(v)))
+	w.buf = append(w.buf, v...)
+}
+
+func (w *juteWriter) writeString(v string) {
+	w.writeBuffer([]byte(v))
+}
+
+func (w *juteWriter) bytes() []byte { return w.buf }
+
+type juteReader struct {
+	buf []byte
+	pos int
+	err error
+}
+
+func newJuteReader(buf []byte) *juteReader {
+	return &juteReader{buf: buf}
+}
+
+func (r *juteReader) take(n int) []byte {
+	if r.err != nil || r.pos+n > len(r.buf) {
+		r.err = io.ErrUnexpectedEOF
+		return make([]byte, n)
+	}
+	b := r.buf[r.pos : r.pos+n]
+	r.pos += n
+	return b
+}
+
+func (r *juteReader) skip(n int) { r.take(n) }
+
+func (r *juteReader) readInt32() int32 {
+	return int32(binary.BigEndian.Uint32(r.take(4)))
+}
+
+func (r *juteReader) readInt64() int64 {
+	return int64(binary.BigEndian.Uint64(r.take(8)))
+}
+
+func (r *juteReader) readBuffer() []byte {
+	length := r.readInt32()
+	if length < 0 {
+		return nil
+	}
+	b := r.take(int(length))
+	copied := make([]byte, len(b))
+	copy(copied, b)
+	return copied
+}
+
+func (r *juteReader) readString() string {
+	return string(r.readBuffer())
+}